@@ -0,0 +1,104 @@
+// Package ccp gets accounts from the CyberArk Central Credential Provider Web Service, caching them as cac does.
+//
+//	cfg, err := ccp.LoadConfig("prod")
+//	if err != nil {
+//		return err
+//	}
+//
+//	client, err := ccp.NewClient("prod", cfg)
+//	if err != nil {
+//		return err
+//	}
+//
+//	acct, err := client.Get(ctx, ccp.Query{Object: "db-password"})
+//
+// The cac command does not use this package but the client it wraps, for its templates, output formats, exec and
+// cache commands, which are out of the scope of a library: both fetch and cache accounts the same way.
+package ccp
+
+import (
+	"time"
+
+	"github.com/MartyHub/cac/internal"
+)
+
+type (
+	// Config is the configuration of a CCP Web Service, as set by cac config set.
+	Config = internal.Config
+
+	// KeySource is the passphrase or the file the cache key is derived from.
+	KeySource = internal.KeySource
+)
+
+// Account is an account fetched from CyberArk or from the cache, with its error if any.
+type Account struct {
+	// Object is the query of the account, e.g. "prod-db/OBJECT?UserName=admin".
+	Object string
+	// Value is the password, i.e. the Content property.
+	Value string
+	// Properties are the other properties returned by CCP, e.g. UserName.
+	Properties map[string]string
+	// Error tells why the account could not be fetched, nil if fetched.
+	Error error
+	// StatusCode is the HTTP status answered by CCP.
+	StatusCode int
+	// Timestamp is when the value was fetched from CyberArk, possibly before being cached.
+	Timestamp time.Time
+	// Stale tells whether the value expired, used because CyberArk failed or while being fetched again.
+	Stale bool
+	// Host is the CCP host which served the account.
+	Host string
+}
+
+func newAccount(acct internal.Account) Account {
+	return Account{
+		Object:     acct.Object,
+		Value:      acct.Value,
+		Properties: acct.Properties,
+		Error:      acct.Error,
+		StatusCode: acct.StatusCode,
+		Timestamp:  acct.Timestamp,
+		Stale:      acct.Stale,
+		Host:       acct.Host,
+	}
+}
+
+// Criteria are the optional CCP query parameters used to look up an account.
+type Criteria struct {
+	Address     string
+	Database    string
+	Folder      string
+	PolicyID    string
+	Query       string
+	QueryFormat string // Exact or Regexp
+	UserName    string
+}
+
+// Query identifies an account to get: an object or criteria, of another configuration if any.
+type Query struct {
+	Criteria
+
+	Config string
+	Object string
+}
+
+func (q Query) toInternal() internal.Query {
+	return internal.Query{
+		Criteria: internal.Criteria{
+			Address:     q.Address,
+			Database:    q.Database,
+			Folder:      q.Folder,
+			PolicyID:    q.PolicyID,
+			Query:       q.Query,
+			QueryFormat: q.QueryFormat,
+			UserName:    q.UserName,
+		},
+		Config: q.Config,
+		Object: q.Object,
+	}
+}
+
+// NewConfig returns a configuration with default values.
+func NewConfig() Config {
+	return internal.NewConfig()
+}
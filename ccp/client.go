@@ -0,0 +1,210 @@
+package ccp
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/MartyHub/cac/internal"
+)
+
+// Client gets accounts of a configuration, and of the other ones referenced by queries.
+// It is safe for concurrent use, GetMany also fetching accounts concurrently.
+type Client struct {
+	client internal.Client
+}
+
+type options struct {
+	cacheKey   KeySource
+	httpClient *http.Client
+	loadConfig func(name string) (Config, error)
+	log        *log.Logger
+	tlsConfig  *tls.Config
+	update     func(cfg *Config)
+}
+
+// Option customizes a Client.
+type Option func(o *options)
+
+// WithCache sets the cache backend: keyring, memory, none or sqlite, the default one.
+func WithCache(backend string) Option {
+	return withConfig(func(cfg *Config) {
+		cfg.CacheBackend = backend
+	})
+}
+
+// WithCacheKey sets the source of the key encrypting cached accounts of every configuration, instead of the
+// CAC_CACHE_PASSPHRASE environment variable, then the cache-key-file and key-file of the configuration.
+func WithCacheKey(source KeySource) Option {
+	return func(o *options) {
+		o.cacheKey = source
+	}
+}
+
+// WithConfigLoader sets how the other configurations referenced by queries are loaded, LoadConfig by default.
+func WithConfigLoader(loadConfig func(name string) (Config, error)) Option {
+	return func(o *options) {
+		o.loadConfig = loadConfig
+	}
+}
+
+// WithHTTPClient sets the HTTP client sending requests to CyberArk, for every configuration, taking precedence
+// over WithTLSConfig.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(o *options) {
+		o.httpClient = httpClient
+	}
+}
+
+// WithLogger sets the logger of failed tries, discarded by default.
+func WithLogger(l *log.Logger) Option {
+	return func(o *options) {
+		o.log = l
+	}
+}
+
+// WithRetries sets how many times an account is tried, and the base wait between two tries.
+func WithRetries(maxTries int, wait time.Duration) Option {
+	return withConfig(func(cfg *Config) {
+		cfg.MaxTries = maxTries
+		cfg.Wait = wait
+	})
+}
+
+// WithTLSConfig sets the TLS configuration of every configuration, e.g. with a client certificate not stored in
+// files, instead of their client certificate files.
+// Without key file, the sqlite and keyring caches then need WithCacheKey or CAC_CACHE_PASSPHRASE.
+func WithTLSConfig(tlsConfig *tls.Config) Option {
+	return func(o *options) {
+		o.tlsConfig = tlsConfig
+	}
+}
+
+func withConfig(update func(cfg *Config)) Option {
+	return func(o *options) {
+		previous := o.update
+
+		o.update = func(cfg *Config) {
+			previous(cfg)
+			update(cfg)
+		}
+	}
+}
+
+// NewClient returns a client of the given configuration.
+func NewClient(name string, cfg Config, opts ...Option) (*Client, error) {
+	o := options{
+		loadConfig: LoadConfig,
+		log:        log.New(io.Discard, "", 0),
+		update:     func(*Config) {},
+	}
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	o.update(&cfg)
+
+	if err := validate(cfg); err != nil {
+		return nil, err
+	}
+
+	params := internal.NewParameters().WithLog(o.log)
+	params.CacheKey = o.cacheKey
+	params.CfgName = name
+	params.Config = cfg
+	params.HTTPClient = o.newHTTPClient
+	params.LoadConfig = o.loadConfig
+
+	client, err := internal.NewQuietClient(params)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{client: client}, nil
+}
+
+// newHTTPClient returns the HTTP client of the given configuration, the main one or another one referenced by
+// queries: the one of WithHTTPClient if any, otherwise one using the TLS configuration of WithTLSConfig if any.
+func (o options) newHTTPClient(cfg Config) (*http.Client, error) {
+	if o.httpClient != nil {
+		return o.httpClient, nil
+	}
+
+	return internal.NewHTTPClient(cfg, o.tlsConfig)
+}
+
+func validate(cfg Config) error {
+	var errs []string
+
+	if cfg.Host == "" && len(cfg.Hosts) == 0 {
+		errs = append(errs, "host is mandatory")
+	}
+
+	if cfg.AppID == "" {
+		errs = append(errs, "application id is mandatory")
+	}
+
+	if cfg.Safe == "" {
+		errs = append(errs, "safe is mandatory")
+	}
+
+	if cfg.MaxTries <= 0 {
+		errs = append(errs, "max tries must be > 0")
+	}
+
+	if cfg.CacheBackend != "" && !internal.Contains(internal.CacheBackends(), cfg.CacheBackend) {
+		errs = append(errs, "unknown cache backend "+cfg.CacheBackend)
+	}
+
+	if len(errs) > 0 {
+		return internal.NewError(nil, "invalid config: %s", strings.Join(errs, ", "))
+	}
+
+	return nil
+}
+
+// Get returns the account of the given query, from the cache or from CyberArk.
+func (c *Client) Get(ctx context.Context, q Query) (Account, error) {
+	accounts, err := c.GetMany(ctx, []Query{q})
+	if len(accounts) == 0 {
+		return Account{}, err
+	}
+
+	if accounts[0].Error != nil {
+		return accounts[0], accounts[0].Error
+	}
+
+	return accounts[0], err
+}
+
+// GetMany returns the accounts of the given queries in the same order, fetching them concurrently.
+// Failed accounts hold their error, the returned one counting them.
+func (c *Client) GetMany(ctx context.Context, queries []Query) ([]Account, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	requests := make([]internal.Query, len(queries))
+
+	for i, q := range queries {
+		requests[i] = q.toInternal()
+	}
+
+	accounts, err := c.client.Get(ctx, requests)
+	if accounts == nil {
+		return nil, err
+	}
+
+	result := make([]Account, len(accounts))
+
+	for i, acct := range accounts {
+		result[i] = newAccount(acct)
+	}
+
+	return result, err
+}
@@ -0,0 +1,248 @@
+package ccp
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MartyHub/cac/internal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestServer returns a configuration of a test CCP Web Service, counting its calls.
+func newTestServer(t *testing.T) (*httptest.Server, Config, *atomic.Int32) {
+	t.Helper()
+
+	calls := &atomic.Int32{}
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+
+		object := r.URL.Query().Get("Object")
+		if object == "unknown" {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = fmt.Fprint(w, `{"ErrorCode": "APPAP004E", "ErrorMsg": "Password object matching query not found"}`)
+
+			return
+		}
+
+		_, _ = fmt.Fprintf(w, `{"Content": "value for %s", "UserName": "%s"}`, object, r.URL.Query().Get("UserName"))
+	}))
+
+	t.Cleanup(ts.Close)
+
+	u, err := url.Parse(ts.URL)
+	require.NoError(t, err)
+
+	cfg := NewConfig()
+	cfg.AppID = "appId"
+	cfg.Host = u.Host
+	cfg.Safe = "safe"
+
+	// default SQLite cache
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	t.Setenv(internal.PassphraseEnv, "test passphrase")
+
+	return ts, cfg, calls
+}
+
+func newTestClient(t *testing.T, opts ...Option) (*Client, *atomic.Int32) {
+	t.Helper()
+
+	ts, cfg, calls := newTestServer(t)
+
+	client, err := NewClient(
+		t.Name(),
+		cfg,
+		append([]Option{WithHTTPClient(ts.Client()), WithRetries(1, time.Millisecond)}, opts...)...,
+	)
+	require.NoError(t, err)
+
+	return client, calls
+}
+
+func TestClient_Get(t *testing.T) {
+	client, calls := newTestClient(t)
+
+	acct, err := client.Get(context.Background(), Query{Object: "o1"})
+	require.NoError(t, err)
+	assert.Equal(t, "value for o1", acct.Value)
+
+	acct, err = client.Get(context.Background(), Query{Object: "o1"})
+	require.NoError(t, err)
+	assert.Equal(t, "value for o1", acct.Value)
+	assert.Equal(t, int32(1), calls.Load(), "cached")
+
+	acct, err = client.Get(context.Background(), Query{Object: "unknown"})
+	require.Error(t, err)
+	assert.Equal(t, http.StatusNotFound, acct.StatusCode)
+}
+
+func TestClient_Get_memory(t *testing.T) {
+	client, calls := newTestClient(t, WithCache("memory"))
+
+	for range 2 {
+		acct, err := client.Get(context.Background(), Query{Object: "o1"})
+		require.NoError(t, err)
+		assert.Equal(t, "value for o1", acct.Value)
+	}
+
+	assert.Equal(t, int32(1), calls.Load(), "cached")
+}
+
+func TestClient_Get_tlsConfig(t *testing.T) {
+	ts, cfg, calls := newTestServer(t)
+	t.Setenv(internal.PassphraseEnv, "")
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ts.Certificate())
+
+	client, err := NewClient("test", cfg, WithTLSConfig(&tls.Config{MinVersion: tls.VersionTLS12, RootCAs: roots}))
+	require.NoError(t, err)
+
+	_, err = client.Get(context.Background(), Query{Object: "o1"})
+	require.Error(t, err, "no cache key")
+
+	client, err = NewClient(
+		"test",
+		cfg,
+		WithTLSConfig(&tls.Config{MinVersion: tls.VersionTLS12, RootCAs: roots}),
+		WithCacheKey(KeySource{Passphrase: "test passphrase"}),
+		WithConfigLoader(func(string) (Config, error) {
+			return cfg, nil
+		}),
+	)
+	require.NoError(t, err)
+
+	for range 2 {
+		for _, config := range []string{"", "other"} {
+			acct, err := client.Get(context.Background(), Query{Config: config, Object: "o1"})
+			require.NoError(t, err, "TLS configuration and cache key of every configuration")
+			assert.Equal(t, "value for o1", acct.Value)
+		}
+	}
+
+	assert.Equal(t, int32(2), calls.Load(), "cached")
+}
+
+func TestClient_GetMany(t *testing.T) {
+	client, _ := newTestClient(t)
+
+	accounts, err := client.GetMany(context.Background(), []Query{
+		{Object: "o2"},
+		{Object: "o1", Criteria: Criteria{UserName: "admin"}},
+		{Object: "unknown"},
+	})
+	require.Error(t, err)
+	require.Len(t, accounts, 3)
+	assert.Equal(t, "value for o2", accounts[0].Value)
+	assert.Equal(t, "o1?UserName=admin", accounts[1].Object)
+	assert.Equal(t, "admin", accounts[1].Properties["UserName"])
+	require.Error(t, accounts[2].Error)
+}
+
+func TestClient_Get_concurrent(t *testing.T) {
+	slow := make(chan struct{})
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		object := r.URL.Query().Get("Object")
+		if object == "slow" {
+			<-slow
+		}
+
+		_, _ = fmt.Fprintf(w, `{"Content": "value for %s in %s"}`, object, r.URL.Query().Get("Safe"))
+	}))
+
+	t.Cleanup(ts.Close)
+
+	_, cfg, _ := newTestServer(t)
+	u, err := url.Parse(ts.URL)
+	require.NoError(t, err)
+
+	cfg.CacheBackend = "memory"
+	cfg.Host = u.Host
+
+	client, err := NewClient(
+		"test",
+		cfg,
+		WithHTTPClient(ts.Client()),
+		WithConfigLoader(func(name string) (Config, error) {
+			other := cfg
+			other.Safe = name
+
+			return other, nil
+		}),
+	)
+	require.NoError(t, err)
+
+	done := make(chan error)
+
+	go func() {
+		_, err := client.Get(context.Background(), Query{Object: "slow"})
+		done <- err
+	}()
+
+	wg := sync.WaitGroup{}
+
+	for i := range 10 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			config := fmt.Sprintf("other%d", i%3)
+			acct, err := client.Get(context.Background(), Query{Config: config, Object: "o1"})
+			assert.NoError(t, err)
+			assert.Equal(t, "value for o1 in "+config, acct.Value)
+		}()
+	}
+
+	wg.Wait()
+
+	select {
+	case <-done:
+		t.Fatal("slow call done before being unblocked")
+	default:
+	}
+
+	close(slow)
+	require.NoError(t, <-done)
+}
+
+func TestClient_GetMany_canceled(t *testing.T) {
+	client, calls := newTestClient(t)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	cancel()
+
+	_, err := client.GetMany(ctx, []Query{{Object: "o1"}})
+	require.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, int32(0), calls.Load())
+}
+
+func TestNewClient(t *testing.T) {
+	cfg := NewConfig()
+
+	_, err := NewClient("test", cfg)
+	require.Error(t, err, "invalid config")
+
+	cfg.AppID = "appId"
+	cfg.Host = "localhost"
+	cfg.Safe = "safe"
+
+	_, err = NewClient("test", cfg)
+	require.Error(t, err, "no certificate")
+
+	_, err = NewClient("test", cfg, WithTLSConfig(&tls.Config{MinVersion: tls.VersionTLS12}))
+	require.NoError(t, err)
+
+	_, err = NewClient("test", cfg, WithTLSConfig(&tls.Config{MinVersion: tls.VersionTLS12}), WithCache("unknown"))
+	require.Error(t, err)
+}
@@ -0,0 +1,77 @@
+package ccp
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/MartyHub/cac/internal"
+)
+
+const extJSON = ".json"
+
+// LoadConfig reads the configuration of the given name or alias from the configuration home of cac,
+// $XDG_CONFIG_HOME/cac by default.
+func LoadConfig(name string) (Config, error) {
+	var result Config
+
+	configHome, err := internal.GetConfigHome()
+	if err != nil {
+		return result, err
+	}
+
+	result, err = LoadConfigFile(filepath.Join(configHome, name+extJSON))
+	if err == nil {
+		return result, nil
+	}
+
+	if !errors.Is(err, os.ErrNotExist) {
+		return result, err
+	}
+
+	return loadConfigAlias(configHome, name)
+}
+
+// LoadConfigFile reads the configuration of the given file.
+func LoadConfigFile(file string) (Config, error) {
+	var result Config
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return result, err
+	}
+
+	err = json.Unmarshal(data, &result)
+
+	return result, err
+}
+
+func loadConfigAlias(configHome, alias string) (Config, error) {
+	var result Config
+
+	entries, err := os.ReadDir(configHome)
+	if err != nil {
+		return result, err
+	}
+
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), extJSON) {
+			continue
+		}
+
+		file := filepath.Join(configHome, entry.Name())
+
+		result, err = LoadConfigFile(file)
+		if err != nil {
+			return result, err
+		}
+
+		if internal.Contains(result.Aliases, alias) {
+			return result, nil
+		}
+	}
+
+	return result, internal.NewError(nil, "failed to find config %q", alias)
+}
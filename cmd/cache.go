@@ -1,6 +1,12 @@
 package cmd
 
 import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/MartyHub/cac/ccp"
 	"github.com/MartyHub/cac/internal"
 	"github.com/spf13/cobra"
 )
@@ -12,31 +18,174 @@ func newCacheCommand() *cobra.Command {
 	}
 
 	result.AddCommand(
+		newCacheExportCommand(),
+		newCacheImportCommand(),
 		newCacheListCommand(),
+		newCacheRefreshCommand(),
+		newCacheRekeyCommand(),
 		newCacheRemoveCommand(),
+		newCacheStatsCommand(),
 	)
 
 	return result
 }
 
+func newCacheExportCommand() *cobra.Command {
+	keyFile := ""
+	out := ""
+	result := &cobra.Command{
+		Use:   "export <config>",
+		Args:  cobra.ExactArgs(1),
+		Short: "Export a cache as an encrypted bundle",
+		Long: "Export the cached accounts of a configuration as a bundle, encrypted with a key derived from " +
+			internal.BundlePassphraseEnv + " if set, from the given key file otherwise.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCacheExport(cmd, args[0], out, bundleKeySource(keyFile))
+		},
+		ValidArgsFunction: completeConfig,
+	}
+
+	result.Flags().StringVar(&keyFile, keyFileName, "", "Bundle key file")
+	result.Flags().StringVar(&out, outName, "", "Bundle file")
+	_ = result.MarkFlagRequired(outName)
+	_ = result.MarkFlagFilename(outName)
+
+	return result
+}
+
+func runCacheExport(cmd *cobra.Command, config, out string, source internal.KeySource) error {
+	cfg, err := ccp.LoadConfig(config)
+	if err != nil {
+		return err
+	}
+
+	cache, err := internal.NewDBCache()
+	if err != nil {
+		return err
+	}
+
+	defer cache.Close()
+
+	if err = cache.Unlock(config, internal.NewKeySource(cfg)); err != nil {
+		return err
+	}
+
+	cached, err := cache.SortedAccounts(config, "", nil)
+	if err != nil {
+		return err
+	}
+
+	accounts := make([]internal.Account, 0, len(cached))
+
+	for _, acct := range cached {
+		if acct.Error != nil {
+			cmd.PrintErrf("Skipping %s: %v\n", acct.Object, acct.Error)
+
+			continue
+		}
+
+		accounts = append(accounts, acct)
+	}
+
+	f, err := os.OpenFile(out, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, rw)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	bundle := internal.NewBundle(config, accounts)
+
+	if err = bundle.Write(f, source); err != nil {
+		return err
+	}
+
+	cmd.Printf("%d account(s) exported\n", bundle.Len())
+
+	return f.Close()
+}
+
+func newCacheImportCommand() *cobra.Command {
+	keyFile := ""
+	result := &cobra.Command{
+		Use:   "import <bundle>",
+		Args:  cobra.ExactArgs(1),
+		Short: "Import a bundle into the cache",
+		Long: "Import a bundle exported by another machine into the cache of its configuration, which must exist.\n\n" +
+			"The bundle key is derived from " + internal.BundlePassphraseEnv + " if set, " +
+			"from the given key file otherwise.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCacheImport(cmd, args[0], bundleKeySource(keyFile))
+		},
+	}
+
+	result.Flags().StringVar(&keyFile, keyFileName, "", "Bundle key file")
+
+	return result
+}
+
+func runCacheImport(cmd *cobra.Command, file string, source internal.KeySource) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	bundle, err := internal.ReadBundle(f, source)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := ccp.LoadConfig(bundle.Config)
+	if err != nil {
+		return err
+	}
+
+	cache, err := internal.NewDBCache()
+	if err != nil {
+		return err
+	}
+
+	defer cache.Close()
+
+	if err = cache.Unlock(bundle.Config, internal.NewKeySource(cfg)); err != nil {
+		return err
+	}
+
+	if err = cache.Import(bundle); err != nil {
+		return err
+	}
+
+	cmd.Printf("%d account(s) imported into %s\n", bundle.Len(), bundle.Config)
+
+	return nil
+}
+
+func bundleKeySource(keyFile string) internal.KeySource {
+	return internal.KeySource{Passphrase: os.Getenv(internal.BundlePassphraseEnv), File: keyFile}
+}
+
 func newCacheListCommand() *cobra.Command {
+	backend := ""
 	verbose := false
 	result := &cobra.Command{
 		Use:     "list",
 		Aliases: []string{"ls"},
 		Short:   "List caches",
 		RunE: func(cmd *cobra.Command, _ []string) error {
-			return runCacheList(cmd, verbose)
+			return runCacheList(cmd, backend, verbose)
 		},
 	}
 
+	addCacheBackendFlag(result, &backend, "sqlite")
 	result.Flags().BoolVarP(&verbose, "verbose", "v", false, "Verbose output")
 
 	return result
 }
 
-func runCacheList(cmd *cobra.Command, verbose bool) error {
-	cache, err := internal.NewDBCache()
+func runCacheList(cmd *cobra.Command, backend string, verbose bool) error {
+	cache, err := internal.NewCache(backend)
 	if err != nil {
 		return err
 	}
@@ -61,27 +210,184 @@ func runCacheList(cmd *cobra.Command, verbose bool) error {
 	return nil
 }
 
-func printCache(cmd *cobra.Command, cache internal.DBCache, config string) error {
+func printCache(cmd *cobra.Command, cache internal.Cache, config string) error {
+	// values of a removed configuration cannot be decrypted anymore
+	if cfg, err := ccp.LoadConfig(config); err == nil {
+		if err = cache.Unlock(config, internal.NewKeySource(cfg)); err != nil {
+			return err
+		}
+	}
+
 	accounts, err := cache.SortedAccounts(config, "", nil)
 	if err != nil {
 		return err
 	}
 
+	now := time.Now()
+
 	for _, acct := range accounts {
+		if acct.Error != nil {
+			cmd.Println("  ", acct.Object, ":", acct.Error)
+
+			continue
+		}
+
 		cmd.Println("  ", acct.Object, "=", acct.Value)
+		cmd.Println("     ", cacheInfo(acct, now))
+	}
+
+	return nil
+}
+
+// cacheInfo tells how old and how used a cached account is.
+func cacheInfo(acct internal.Account, now time.Time) string {
+	accessed := "never"
+	if !acct.AccessedAt.IsZero() {
+		accessed = now.Sub(acct.AccessedAt).Truncate(time.Second).String() + " ago"
+	}
+
+	result := fmt.Sprintf(
+		"age %v, %d hit(s), last accessed %s, status %d after %d try(ies)",
+		now.Sub(acct.Timestamp).Truncate(time.Second),
+		acct.Hits,
+		accessed,
+		acct.StatusCode,
+		acct.Try,
+	)
+
+	if acct.Host != "" {
+		result += " from " + acct.Host
+	}
+
+	return result
+}
+
+func newCacheRefreshCommand() *cobra.Command {
+	var deadline time.Duration
+
+	result := &cobra.Command{
+		Use:   "refresh [config]...",
+		Short: "Fetch again cached accounts",
+		Long: "Fetch again from CyberArk the cached accounts of the given configurations, all of them by default, " +
+			"reporting the accounts whose value changed and the failed ones.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCacheRefresh(cmd, args, deadline)
+		},
+		ValidArgsFunction: completeConfig,
+	}
+
+	result.Flags().DurationVar(&deadline, deadlineName, 0, "Max duration to refresh each config, unlimited by default")
+
+	return result
+}
+
+func runCacheRefresh(cmd *cobra.Command, configs []string, deadline time.Duration) error {
+	if len(configs) == 0 {
+		var err error
+
+		if configs, err = getConfigs(""); err != nil {
+			return err
+		}
+	}
+
+	failures := 0
+
+	for _, config := range configs {
+		cmd.Println(config)
+
+		if err := refreshCache(cmd.Context(), config, deadline); err != nil {
+			cmd.PrintErrln(err)
+
+			failures++
+		}
+	}
+
+	if failures > 0 {
+		return internal.NewError(nil, "failed to refresh %d / %d config(s)", failures, len(configs))
+	}
+
+	return nil
+}
+
+func refreshCache(ctx context.Context, config string, deadline time.Duration) error {
+	var err error
+
+	params := internal.NewParameters()
+	params.CfgName = config
+	params.Deadline = deadline
+
+	params.Config, err = ccp.LoadConfig(config)
+	if err != nil {
+		return err
+	}
+
+	params.LoadConfig = ccp.LoadConfig
+
+	client, err := internal.NewClient(params)
+	if err != nil {
+		return err
+	}
+
+	return client.Refresh(ctx)
+}
+
+func newCacheRekeyCommand() *cobra.Command {
+	oldKeyFile := ""
+	result := &cobra.Command{
+		Use:   "rekey <config>",
+		Args:  cobra.ExactArgs(1),
+		Short: "Encrypt a cache again with the current key",
+		Long: "Encrypt a cache again with the current key of its configuration.\n\n" +
+			"The old key is derived from " + oldPassphraseEnv + " if set, from the old key file otherwise, " +
+			"the key file of the configuration by default.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCacheRekey(cmd, args[0], oldKeyFile)
+		},
+		ValidArgsFunction: completeConfig,
+	}
+
+	result.Flags().StringVar(&oldKeyFile, oldKeyFileName, "", "Old cache key file")
+
+	return result
+}
+
+func runCacheRekey(cmd *cobra.Command, config, oldKeyFile string) error {
+	cfg, err := ccp.LoadConfig(config)
+	if err != nil {
+		return err
+	}
+
+	old := internal.KeySource{Passphrase: os.Getenv(oldPassphraseEnv), File: oldKeyFile}
+	if old.Passphrase == "" && old.File == "" {
+		old.File = cfg.KeyFile
+	}
+
+	cache, err := internal.NewDBCache()
+	if err != nil {
+		return err
+	}
+
+	defer cache.Close()
+
+	count, err := cache.Rekey(config, old, internal.NewKeySource(cfg))
+	if err != nil {
+		return err
 	}
 
+	cmd.Printf("%d account(s) encrypted again\n", count)
+
 	return nil
 }
 
 func newCacheRemoveCommand() *cobra.Command {
+	backend := ""
 	result := &cobra.Command{
-		Use:     "remove <cache>",
+		Use:     "remove <cache> [account]...",
 		Aliases: []string{"rm"},
-		Args:    cobra.ExactArgs(1),
-		Short:   "Remove a cache",
+		Args:    cobra.MinimumNArgs(1),
+		Short:   "Remove a cache, or only the given accounts",
 		RunE: func(_ *cobra.Command, args []string) error {
-			return runCacheRemove(args[0])
+			return runCacheRemove(backend, args[0], args[1:])
 		},
 		ValidArgsFunction: func(
 			_ *cobra.Command,
@@ -89,10 +395,17 @@ func newCacheRemoveCommand() *cobra.Command {
 			toComplete string,
 		) ([]string, cobra.ShellCompDirective) {
 			if len(args) != 0 {
-				return nil, cobra.ShellCompDirectiveNoFileComp
+				cache, err := newConfigCache(backend, args[0])
+				if err != nil {
+					return nil, cobra.ShellCompDirectiveError
+				}
+
+				defer cache.Close()
+
+				return completeCachedAccount(cache, args[0], args[1:], toComplete)
 			}
 
-			cache, err := internal.NewDBCache()
+			cache, err := internal.NewCache(backend)
 			if err != nil {
 				return nil, cobra.ShellCompDirectiveError
 			}
@@ -108,16 +421,95 @@ func newCacheRemoveCommand() *cobra.Command {
 		},
 	}
 
+	addCacheBackendFlag(result, &backend, "the one of the config")
+
 	return result
 }
 
-func runCacheRemove(config string) error {
-	cache, err := internal.NewDBCache()
+func runCacheRemove(backend, config string, names []string) error {
+	cache, err := newConfigCache(backend, config)
 	if err != nil {
 		return err
 	}
 
 	defer cache.Close()
 
+	if len(names) > 0 {
+		return cache.Remove(config, names...)
+	}
+
 	return cache.RemoveAll(config)
 }
+
+func newCacheStatsCommand() *cobra.Command {
+	backend := ""
+	result := &cobra.Command{
+		Use:   "stats [cache]...",
+		Short: "Show statistics of caches",
+		Long:  "Show statistics of the given caches, all of them by default, from the metadata of their accounts.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCacheStats(cmd, backend, args)
+		},
+	}
+
+	addCacheBackendFlag(result, &backend, "the one of the config, else sqlite")
+
+	return result
+}
+
+func runCacheStats(cmd *cobra.Command, backend string, configs []string) error {
+	if len(configs) == 0 {
+		cache, err := internal.NewCache(backend)
+		if err != nil {
+			return err
+		}
+
+		configs, err = cache.Configs("")
+		cache.Close()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+
+	for _, config := range configs {
+		stats, err := cacheStats(backend, config, now)
+		if err != nil {
+			return err
+		}
+
+		cmd.Printf("%s: %v\n", config, stats)
+	}
+
+	return nil
+}
+
+func cacheStats(backend, config string, now time.Time) (internal.CacheStats, error) {
+	cache, err := newConfigCache(backend, config)
+	if err != nil {
+		return internal.CacheStats{}, err
+	}
+
+	defer cache.Close()
+
+	accounts, err := cache.SortedAccounts(config, "", nil)
+	if err != nil {
+		return internal.CacheStats{}, err
+	}
+
+	return internal.NewCacheStats(accounts, now), nil
+}
+
+// newConfigCache opens the cache of a configuration: the given backend, the one of the configuration by default.
+func newConfigCache(backend, config string) (internal.Cache, error) {
+	if backend == "" {
+		// the cache of a removed configuration is still in the default backend
+		if cfg, err := ccp.LoadConfig(config); err == nil {
+			backend = cfg.CacheBackend
+		}
+	}
+
+	return internal.NewCache(backend)
+}
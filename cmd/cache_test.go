@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/MartyHub/cac/internal"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_configCache(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	stateHome := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", stateHome)
+
+	set := newConfigSetCommand()
+	set.SetArgs([]string{"test", "--cache-backend", "memory"})
+	require.NoError(t, set.Execute())
+
+	cmd := &cobra.Command{}
+	buf := &bytes.Buffer{}
+	cmd.SetOut(buf)
+
+	require.NoError(t, runCacheRemove("", "test", []string{"test_account"}))
+	require.NoError(t, runCacheStats(cmd, "", []string{"test"}))
+	assert.Contains(t, buf.String(), "test: ")
+
+	// the SQLite cache was never opened
+	_, err := os.Stat(filepath.Join(stateHome, "cac", "accounts.sqlite"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	require.NoError(t, runCacheRemove("sqlite", "test", nil))
+
+	_, err = os.Stat(filepath.Join(stateHome, "cac", "accounts.sqlite"))
+	assert.NoError(t, err)
+}
+
+func Test_cacheInfo(t *testing.T) {
+	now := time.Date(2023, 2, 21, 19, 45, 48, 0, time.UTC)
+
+	assert.Equal(
+		t,
+		"age 2h0m0s, 0 hit(s), last accessed never, status 200 after 1 try(ies)",
+		cacheInfo(internal.Account{StatusCode: 200, Try: 1, Timestamp: now.Add(-2 * time.Hour)}, now),
+	)
+	assert.Equal(
+		t,
+		"age 1h0m0s, 3 hit(s), last accessed 5m0s ago, status 200 after 2 try(ies) from ccp.example.com",
+		cacheInfo(internal.Account{
+			StatusCode: 200,
+			Try:        2,
+			Timestamp:  now.Add(-time.Hour),
+			Host:       "ccp.example.com",
+			Hits:       3,
+			AccessedAt: now.Add(-5 * time.Minute),
+		}, now),
+	)
+}
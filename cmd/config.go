@@ -7,27 +7,71 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/MartyHub/cac/ccp"
 	"github.com/MartyHub/cac/internal"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 const (
+	addressName        = "address"
 	aliasesName        = "aliases"
+	annotationName     = "annotation"
 	appIDName          = "app-id"
+	breakerResetName   = "breaker-cooldown"
+	breakerName        = "breaker-threshold"
+	cacheBackendName   = "cache-backend"
+	cacheKeyFileName   = "cache-key-file"
 	certFileName       = "cert-file"
+	databaseName       = "database"
+	deadlineName       = "deadline"
+	envName            = "env"
+	envFileName        = "env-file"
+	exportName         = "export"
 	expiryName         = "expiry"
+	fallbackName       = "fallback-to-cache"
+	folderName         = "folder"
+	formatName         = "format"
 	hostName           = "host"
+	hostCooldownName   = "host-cooldown"
+	hostsName          = "hosts"
+	jitterName         = "jitter"
 	jsonName           = "json"
 	keyFileName        = "key-file"
+	labelName          = "label"
 	maxConnectionsName = "max-connections"
+	maxStaleName       = "max-stale"
 	maxTriesName       = "max-tries"
+	maxWaitName        = "max-wait"
+	nameName           = "name"
+	oldKeyFileName     = "old-key-file"
+	outName            = "out"
+	namespaceName      = "namespace"
+	noCacheName        = "no-cache"
+	offlineName        = "offline"
 	outputName         = "output"
+	policyIDName       = "policy-id"
+	propertiesName     = "properties"
+	queryName          = "query"
+	queryFormatName    = "query-format"
+	rateName           = "rate"
+	refreshName        = "refresh"
+	retryCodesName     = "retry-error-codes"
+	retryStatusesName  = "retry-statuses"
 	safeName           = "safe"
+	shellName          = "shell"
 	skipVerifyName     = "skip-verify"
+	staleName          = "stale-while-revalidate"
+	statsName          = "stats"
+	templateName       = "template"
 	timeoutName        = "timeout"
+	userNameName       = "username"
+	varName            = "var"
 	waitName           = "wait"
 
 	extJSON = ".json"
+
+	oldPassphraseEnv = "CAC_CACHE_OLD_PASSPHRASE"
 )
 
 const rw = 0o600
@@ -82,67 +126,6 @@ func runConfigList(cmd *cobra.Command, verbose bool) error {
 	return nil
 }
 
-func readConfigFile(file string) (internal.Config, error) {
-	var result internal.Config
-
-	data, err := os.ReadFile(file)
-	if err != nil {
-		return result, err
-	}
-
-	err = json.Unmarshal(data, &result)
-
-	return result, err
-}
-
-func readConfig(name string) (internal.Config, error) {
-	var result internal.Config
-
-	configHome, err := internal.GetConfigHome()
-	if err != nil {
-		return result, err
-	}
-
-	result, err = readConfigFile(filepath.Join(configHome, name+extJSON))
-	if err == nil {
-		return result, nil
-	}
-
-	if !errors.Is(err, os.ErrNotExist) {
-		return result, err
-	}
-
-	return readConfigAlias(configHome, name)
-}
-
-func readConfigAlias(configHome, alias string) (internal.Config, error) {
-	var result internal.Config
-
-	entries, err := os.ReadDir(configHome)
-	if err != nil {
-		return result, err
-	}
-
-	for _, entry := range entries {
-		if !strings.HasSuffix(entry.Name(), extJSON) {
-			continue
-		}
-
-		file := filepath.Join(configHome, entry.Name())
-
-		result, err = readConfigFile(file)
-		if err != nil {
-			return result, err
-		}
-
-		if internal.Contains(result.Aliases, alias) {
-			return result, nil
-		}
-	}
-
-	return result, internal.NewError(nil, "failed to find config %q", alias)
-}
-
 func writeConfig(file string, cfg internal.Config) error {
 	data, err := json.MarshalIndent(cfg, "", "  ")
 	if err != nil {
@@ -153,7 +136,7 @@ func writeConfig(file string, cfg internal.Config) error {
 }
 
 func printConfig(cmd *cobra.Command, file string) error {
-	cfg, err := readConfigFile(file)
+	cfg, err := ccp.LoadConfigFile(file)
 	if err != nil {
 		return err
 	}
@@ -193,8 +176,8 @@ func newConfigSetCommand() *cobra.Command {
 		Use:   "set <config>",
 		Args:  cobra.ExactArgs(1),
 		Short: "Add or update a configuration",
-		RunE: func(_ *cobra.Command, args []string) error {
-			return runConfigSet(args[0], cfg)
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runConfigSet(cmd, args[0], cfg)
 		},
 		ValidArgsFunction: completeConfig,
 	}
@@ -205,6 +188,23 @@ func newConfigSetCommand() *cobra.Command {
 	result.Flags().StringVar(&cfg.AppID, appIDName, "", "CyberArk Application Id")
 	_ = result.RegisterFlagCompletionFunc(appIDName, cobra.NoFileCompletions)
 
+	result.Flags().DurationVar(
+		&cfg.BreakerCooldown,
+		breakerResetName,
+		0,
+		"Duration requests are not sent once the circuit breaker is open, 30s by default",
+	)
+	result.Flags().IntVar(
+		&cfg.BreakerThreshold,
+		breakerName,
+		0,
+		"Consecutive failures opening the circuit breaker, failing remaining accounts fast, disabled by default",
+	)
+
+	addCacheBackendFlag(result, &cfg.CacheBackend, "sqlite")
+
+	result.Flags().StringVar(&cfg.CacheKeyFile, cacheKeyFileName, "", "Cache key file, the key file by default")
+
 	result.Flags().StringVar(&cfg.CertFile, certFileName, "", "Certificate file")
 	_ = result.MarkFlagFilename(certFileName, "cer", "cert", "crt", "pem")
 
@@ -213,23 +213,125 @@ func newConfigSetCommand() *cobra.Command {
 	result.Flags().StringVar(&cfg.Host, hostName, "", "CyberArk CCP REST Web Service Host")
 	_ = result.RegisterFlagCompletionFunc(hostName, cobra.NoFileCompletions)
 
+	result.Flags().DurationVar(&cfg.HostCooldown, hostCooldownName, 0, "Duration a failing host is left aside, 30s by default")
+
+	result.Flags().StringToIntVar(
+		&cfg.Hosts,
+		hostsName,
+		map[string]int{},
+		"Other hosts as HOST=PRIORITY, lower priorities first, the host having priority 0, an empty value clearing them",
+	)
+	hosts := result.Flags().Lookup(hostsName)
+	hosts.Value = clearableValue{Value: hosts.Value, clear: func() { cfg.Hosts = map[string]int{} }}
+	_ = result.RegisterFlagCompletionFunc(hostsName, cobra.NoFileCompletions)
+
+	result.Flags().Float64Var(&cfg.Jitter, jitterName, 0, "Fraction of the wait before retry randomly cut, from 0 to 1")
+
 	result.Flags().StringVar(&cfg.KeyFile, keyFileName, "", "Key file")
 	_ = result.MarkFlagFilename(keyFileName, "cer", "cert", "crt", "key", "pem")
 
 	result.Flags().IntVar(&cfg.MaxConns, maxConnectionsName, cfg.MaxConns, "Max connections")
+	result.Flags().DurationVar(&cfg.MaxStale, maxStaleName, 0, "Max duration a value is used after expiry when CyberArk fails")
 	result.Flags().IntVar(&cfg.MaxTries, maxTriesName, cfg.MaxTries, "Max tries")
+	result.Flags().DurationVar(&cfg.MaxWait, maxWaitName, 0, "Max wait before retry, 30s by default")
+
+	result.Flags().Float64Var(&cfg.Rate, rateName, 0, "Max requests per second, unlimited by default")
+
+	result.Flags().StringSliceVar(
+		&cfg.RetryErrorCodes,
+		retryCodesName,
+		[]string{},
+		"CCP error codes to retry whatever the status (e.g. APPAP004E)",
+	)
+	_ = result.RegisterFlagCompletionFunc(retryCodesName, cobra.NoFileCompletions)
+
+	result.Flags().IntSliceVar(
+		&cfg.RetryStatuses,
+		retryStatusesName,
+		[]int{},
+		"HTTP statuses to retry, 500, 502, 503 and 504 by default",
+	)
+	_ = result.RegisterFlagCompletionFunc(retryStatusesName, cobra.NoFileCompletions)
 
 	result.Flags().StringVar(&cfg.Safe, safeName, "", "CyberArk Safe")
 	_ = result.RegisterFlagCompletionFunc(safeName, cobra.NoFileCompletions)
 
 	result.Flags().BoolVar(&cfg.SkipVerify, skipVerifyName, false, "Skip server certificate verification")
+	result.Flags().BoolVar(
+		&cfg.StaleWhileRevalidate,
+		staleName,
+		false,
+		"Use values expired less than max-stale ago while fetching them again in background",
+	)
 	result.Flags().DurationVar(&cfg.Timeout, timeoutName, cfg.Timeout, "Timeout")
-	result.Flags().DurationVar(&cfg.Wait, waitName, cfg.Wait, "Wait before retry")
+	result.Flags().DurationVar(&cfg.Wait, waitName, cfg.Wait, "Wait before first retry, doubled on each retry")
+
+	addCriteriaFlags(result, &cfg.Criteria)
 
 	return result
 }
 
-func runConfigSet(name string, cfg internal.Config) error {
+func addCacheBackendFlag(cmd *cobra.Command, backend *string, byDefault string) {
+	cmd.Flags().StringVar(
+		backend,
+		cacheBackendName,
+		"",
+		"Cache backend ("+strings.Join(internal.CacheBackends(), ", ")+"), "+byDefault+" by default",
+	)
+	_ = cmd.RegisterFlagCompletionFunc(
+		cacheBackendName,
+		cobra.FixedCompletions(internal.CacheBackends(), cobra.ShellCompDirectiveNoFileComp),
+	)
+}
+
+func addDeadlineFlag(cmd *cobra.Command, params *internal.Parameters) {
+	cmd.Flags().DurationVar(
+		&params.Deadline,
+		deadlineName,
+		0,
+		"Max duration to get all accounts, retries included, unlimited by default",
+	)
+}
+
+func addCacheFlags(cmd *cobra.Command, params *internal.Parameters) {
+	cmd.Flags().BoolVar(
+		&params.FallbackToCache,
+		fallbackName,
+		false,
+		"Use the last known value, even expired, if CyberArk cannot be reached or fails",
+	)
+	cmd.Flags().BoolVar(&params.NoCache, noCacheName, false, "Neither read nor update the cache")
+	cmd.Flags().BoolVar(&params.Offline, offlineName, false, "Only use cached values, even expired")
+	cmd.Flags().BoolVar(&params.Refresh, refreshName, false, "Do not read the cache but update it")
+}
+
+func addCriteriaFlags(cmd *cobra.Command, criteria *internal.Criteria) {
+	cmd.Flags().StringVar(&criteria.Address, addressName, "", "CyberArk account address")
+	_ = cmd.RegisterFlagCompletionFunc(addressName, cobra.NoFileCompletions)
+
+	cmd.Flags().StringVar(&criteria.Database, databaseName, "", "CyberArk account database")
+	_ = cmd.RegisterFlagCompletionFunc(databaseName, cobra.NoFileCompletions)
+
+	cmd.Flags().StringVar(&criteria.Folder, folderName, "", "CyberArk Folder")
+	_ = cmd.RegisterFlagCompletionFunc(folderName, cobra.NoFileCompletions)
+
+	cmd.Flags().StringVar(&criteria.PolicyID, policyIDName, "", "CyberArk Platform Id")
+	_ = cmd.RegisterFlagCompletionFunc(policyIDName, cobra.NoFileCompletions)
+
+	cmd.Flags().StringVar(&criteria.Query, queryName, "", "CyberArk free query")
+	_ = cmd.RegisterFlagCompletionFunc(queryName, cobra.NoFileCompletions)
+
+	cmd.Flags().StringVar(&criteria.QueryFormat, queryFormatName, "", "CyberArk query format (Exact or Regexp)")
+	_ = cmd.RegisterFlagCompletionFunc(
+		queryFormatName,
+		cobra.FixedCompletions([]string{"Exact", "Regexp"}, cobra.ShellCompDirectiveNoFileComp),
+	)
+
+	cmd.Flags().StringVar(&criteria.UserName, userNameName, "", "CyberArk account user name")
+	_ = cmd.RegisterFlagCompletionFunc(userNameName, cobra.NoFileCompletions)
+}
+
+func runConfigSet(cmd *cobra.Command, name string, cfg internal.Config) error {
 	configHome, err := internal.GetConfigHome()
 	if err != nil {
 		return err
@@ -237,7 +339,7 @@ func runConfigSet(name string, cfg internal.Config) error {
 
 	file := filepath.Join(configHome, name+".json")
 
-	existCfg, err := readConfigFile(file)
+	existCfg, err := ccp.LoadConfigFile(file)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
 			return writeConfig(file, cfg)
@@ -246,7 +348,46 @@ func runConfigSet(name string, cfg internal.Config) error {
 		return err
 	}
 
-	return writeConfig(file, existCfg.Overwrite(cfg))
+	result := existCfg.Overwrite(cfg)
+
+	// flags whose zero value is a valid setting, overwritten only if given
+	if cmd.Flags().Changed(breakerName) {
+		result.BreakerThreshold = cfg.BreakerThreshold
+	}
+
+	if cmd.Flags().Changed(hostsName) {
+		result.Hosts = cfg.Hosts
+	}
+
+	if cmd.Flags().Changed(jitterName) {
+		result.Jitter = cfg.Jitter
+	}
+
+	if cmd.Flags().Changed(rateName) {
+		result.Rate = cfg.Rate
+	}
+
+	if cmd.Flags().Changed(staleName) {
+		result.StaleWhileRevalidate = cfg.StaleWhileRevalidate
+	}
+
+	return writeConfig(file, result)
+}
+
+// clearableValue is a flag value which an empty value clears, instead of failing to parse it.
+type clearableValue struct {
+	pflag.Value
+	clear func()
+}
+
+func (v clearableValue) Set(value string) error {
+	if value == "" {
+		v.clear()
+
+		return nil
+	}
+
+	return v.Value.Set(value)
 }
 
 func completeConfig(_ *cobra.Command, _ []string, toComplete string) ([]string, cobra.ShellCompDirective) {
@@ -3,7 +3,10 @@ package cmd
 import (
 	"bytes"
 	"testing"
+	"time"
 
+	"github.com/MartyHub/cac/ccp"
+	"github.com/MartyHub/cac/internal"
 	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -22,40 +25,47 @@ func Test_runConfigList(t *testing.T) {
 	assert.Equal(t, "json_config\n", buf.String())
 }
 
-func Test_readConfigAlias(t *testing.T) {
-	type args struct {
-		configHome string
-		alias      string
-	}
+func Test_runConfigSet(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
 
-	tests := []struct {
-		name    string
-		args    args
-		wantErr bool
-	}{
-		{
-			name: "unknown alias",
-			args: args{
-				configHome: "../.config/cac",
-				alias:      "unknown",
-			},
-			wantErr: true,
-		},
-		{
-			name: "valid alias",
-			args: args{
-				configHome: "../.config/cac",
-				alias:      "a1",
-			},
-			wantErr: false,
-		},
-	}
+	set := func(args ...string) internal.Config {
+		t.Helper()
+
+		cmd := newConfigSetCommand()
+		cmd.SetArgs(append([]string{"test"}, args...))
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			if _, err := readConfigAlias(tt.args.configHome, tt.args.alias); (err != nil) != tt.wantErr {
-				t.Errorf("loadConfigAlias() error = %v, wantErr %v", err, tt.wantErr)
-			}
-		})
+		require.NoError(t, cmd.Execute())
+
+		result, err := ccp.LoadConfig("test")
+		require.NoError(t, err)
+
+		return result
 	}
+
+	assert.True(t, set("--host", "ccp.example.com", "--stale-while-revalidate").StaleWhileRevalidate)
+
+	cfg := set("--max-stale", "2h")
+	assert.True(t, cfg.StaleWhileRevalidate, "kept")
+	assert.Equal(t, 2*time.Hour, cfg.MaxStale)
+	assert.Equal(t, "ccp.example.com", cfg.Host)
+
+	assert.False(t, set("--stale-while-revalidate=false").StaleWhileRevalidate)
+
+	cfg = set("--rate", "10", "--breaker-threshold", "3", "--jitter", "0.5", "--hosts", "ccp2.example.com=1")
+	assert.InDelta(t, 10, cfg.Rate, 0)
+	assert.Equal(t, 3, cfg.BreakerThreshold)
+	assert.InDelta(t, 0.5, cfg.Jitter, 0)
+	assert.Equal(t, map[string]int{"ccp2.example.com": 1}, cfg.Hosts)
+
+	cfg = set("--max-tries", "5")
+	assert.InDelta(t, 10, cfg.Rate, 0, "kept")
+	assert.Equal(t, 3, cfg.BreakerThreshold, "kept")
+	assert.InDelta(t, 0.5, cfg.Jitter, 0, "kept")
+	assert.Len(t, cfg.Hosts, 1, "kept")
+
+	cfg = set("--rate", "0", "--breaker-threshold", "0", "--jitter", "0", "--hosts", "")
+	assert.Zero(t, cfg.Rate)
+	assert.Zero(t, cfg.BreakerThreshold)
+	assert.Zero(t, cfg.Jitter)
+	assert.Empty(t, cfg.Hosts)
 }
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"context"
+	"os"
+
+	"github.com/MartyHub/cac/ccp"
+	"github.com/MartyHub/cac/internal"
+	"github.com/spf13/cobra"
+)
+
+func newExecCommand() *cobra.Command {
+	params := internal.NewParameters()
+	result := &cobra.Command{
+		Use:     "exec <config> -- <command> [arg]...",
+		Aliases: []string{"x"},
+		Args:    cobra.MinimumNArgs(2),
+		Short:   "Execute a command with accounts from CyberArk in its environment",
+		Example: "  cac exec test --env DB_USER=MY_DB#UserName --env DB_PASSWORD=MY_DB -- ./start.sh",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runExec(cmd.Context(), args, params)
+		},
+		ValidArgsFunction: func(
+			cmd *cobra.Command,
+			args []string,
+			toComplete string,
+		) ([]string, cobra.ShellCompDirective) {
+			if len(args) == 0 {
+				return completeConfig(cmd, args, toComplete)
+			}
+
+			return nil, cobra.ShellCompDirectiveDefault
+		},
+	}
+
+	result.Flags().StringArrayVarP(&params.Env, envName, "e", nil, "Environment variable as KEY=OBJECT")
+	_ = result.RegisterFlagCompletionFunc(envName, cobra.NoFileCompletions)
+
+	result.Flags().StringVar(&params.EnvFile, envFileName, "", "Environment file using ${CYBERARK:OBJECT} placeholders")
+
+	addCacheFlags(result, &params)
+	addDeadlineFlag(result, &params)
+
+	return result
+}
+
+func runExec(ctx context.Context, args []string, params internal.Parameters) error {
+	var err error
+
+	params.CfgName = args[0]
+
+	params.Config, err = ccp.LoadConfig(params.CfgName)
+	if err != nil {
+		return err
+	}
+
+	params.LoadConfig = ccp.LoadConfig
+
+	if len(params.Env) == 0 && params.EnvFile == "" {
+		return internal.NewError(nil, "either --%s or --%s is required", envName, envFileName)
+	}
+
+	if err = params.Validate(); err != nil {
+		return err
+	}
+
+	client, err := internal.NewClient(params)
+	if err != nil {
+		return err
+	}
+
+	code, err := client.Exec(ctx, args[1], args[2:])
+	if err != nil {
+		return err
+	}
+
+	if code != 0 {
+		os.Exit(code)
+	}
+
+	return nil
+}
@@ -1,21 +1,24 @@
 package cmd
 
 import (
+	"context"
 	"strings"
 
+	"github.com/MartyHub/cac/ccp"
 	"github.com/MartyHub/cac/internal"
 	"github.com/spf13/cobra"
 )
 
 func newGetCommand() *cobra.Command {
 	params := internal.NewParameters()
+	criteria := internal.Criteria{}
 	result := &cobra.Command{
 		Use:     "get <config> <account>...",
 		Aliases: []string{"g"},
 		Args:    cobra.MinimumNArgs(1),
 		Short:   "Get accounts from CyberArk",
-		RunE: func(_ *cobra.Command, args []string) error {
-			return runGet(args, params)
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runGet(cmd.Context(), args, params, criteria)
 		},
 		ValidArgsFunction: func(
 			cmd *cobra.Command,
@@ -30,20 +33,87 @@ func newGetCommand() *cobra.Command {
 		},
 	}
 
-	result.Flags().BoolVarP(&params.JSON, jsonName, "j", false, "Output JSON")
+	result.Flags().BoolVarP(&params.JSON, jsonName, "j", false, "Output JSON, same as --format json")
+	result.Flags().StringVarP(
+		&params.Format,
+		formatName,
+		"f",
+		"shell",
+		"Output format ("+strings.Join(internal.Formats(), ", ")+")",
+	)
+	_ = result.RegisterFlagCompletionFunc(
+		formatName,
+		cobra.FixedCompletions(internal.Formats(), cobra.ShellCompDirectiveNoFileComp),
+	)
 	result.Flags().StringVarP(&params.Output, outputName, "o", "", "Generate files in given output path")
+	result.Flags().StringSliceVarP(
+		&params.Properties,
+		propertiesName,
+		"p",
+		nil,
+		"Also output given account properties (e.g. UserName,Address)",
+	)
+	_ = result.RegisterFlagCompletionFunc(
+		propertiesName,
+		cobra.FixedCompletions(
+			[]string{"Address", "CreationMethod", "Folder", "Name", "PasswordChangeInProgress", "PolicyID", "UserName"},
+			cobra.ShellCompDirectiveNoFileComp,
+		),
+	)
+
+	result.Flags().StringVar(&params.Shell, shellName, "posix", "Shell quoting ("+strings.Join(internal.Shells(), ", ")+")")
+	_ = result.RegisterFlagCompletionFunc(
+		shellName,
+		cobra.FixedCompletions(internal.Shells(), cobra.ShellCompDirectiveNoFileComp),
+	)
+
+	result.Flags().BoolVar(&params.Export, exportName, false, "Export shell variables")
+	result.Flags().BoolVar(&params.Stats, statsName, false, "Print cache and CyberArk statistics, included in JSON output")
+
+	result.Flags().StringToStringVar(&params.Names, varName, nil, "Shell variable name of an account as OBJECT=NAME")
+	_ = result.RegisterFlagCompletionFunc(varName, cobra.NoFileCompletions)
+
+	result.Flags().StringVar(&params.SecretName, nameName, "", "Kubernetes Secret name")
+	_ = result.RegisterFlagCompletionFunc(nameName, cobra.NoFileCompletions)
+
+	result.Flags().StringVarP(&params.Namespace, namespaceName, "n", "", "Kubernetes Secret namespace")
+	_ = result.RegisterFlagCompletionFunc(namespaceName, cobra.NoFileCompletions)
+
+	result.Flags().StringToStringVar(&params.Labels, labelName, nil, "Kubernetes Secret labels as key=value")
+	_ = result.RegisterFlagCompletionFunc(labelName, cobra.NoFileCompletions)
+
+	result.Flags().StringToStringVar(&params.Annotations, annotationName, nil, "Kubernetes Secret annotations as key=value")
+	_ = result.RegisterFlagCompletionFunc(annotationName, cobra.NoFileCompletions)
+
+	addCacheFlags(result, &params)
+	addDeadlineFlag(result, &params)
+	addCriteriaFlags(result, &criteria)
 
 	return result
 }
 
 func completeAccount(config string, exclusions []string, toComplete string) ([]string, cobra.ShellCompDirective) {
-	cache, err := internal.NewDBCache()
+	cfg, err := ccp.LoadConfig(config)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+
+	cache, err := internal.NewCache(cfg.CacheBackend)
 	if err != nil {
 		return nil, cobra.ShellCompDirectiveError
 	}
 
 	defer cache.Close()
 
+	return completeCachedAccount(cache, config, exclusions, toComplete)
+}
+
+func completeCachedAccount(
+	cache internal.Cache,
+	config string,
+	exclusions []string,
+	toComplete string,
+) ([]string, cobra.ShellCompDirective) {
 	accounts, err := cache.SortedAccounts(config, strings.ToLower(toComplete), exclusions)
 	if err != nil {
 		return nil, cobra.ShellCompDirectiveError
@@ -58,17 +128,20 @@ func completeAccount(config string, exclusions []string, toComplete string) ([]s
 	return result, cobra.ShellCompDirectiveNoFileComp
 }
 
-func runGet(args []string, params internal.Parameters) error {
+func runGet(ctx context.Context, args []string, params internal.Parameters, criteria internal.Criteria) error {
 	var err error
 
 	params.CfgName = args[0]
 	params.Objects = args[1:]
 
-	params.Config, err = readConfig(params.CfgName)
+	params.Config, err = ccp.LoadConfig(params.CfgName)
 	if err != nil {
 		return err
 	}
 
+	params.Criteria = params.Criteria.Overwrite(criteria)
+	params.LoadConfig = ccp.LoadConfig
+
 	if err = params.Validate(); err != nil {
 		return err
 	}
@@ -78,5 +151,5 @@ func runGet(args []string, params internal.Parameters) error {
 		return err
 	}
 
-	return client.Run()
+	return client.Run(ctx)
 }
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/MartyHub/cac/ccp"
+	"github.com/MartyHub/cac/internal"
+	"github.com/spf13/cobra"
+)
+
+func newRenderCommand() *cobra.Command {
+	params := internal.NewParameters()
+	result := &cobra.Command{
+		Use:     "render <config>",
+		Aliases: []string{"r"},
+		Args:    cobra.ExactArgs(1),
+		Short:   "Render a Go template with accounts from CyberArk",
+		Long: `Render a Go template with accounts from CyberArk.
+
+Besides the standard Go template functions, the following ones are available:
+  cyberark "OBJECT"                  password of the account
+  cyberarkField "OBJECT" "PROPERTY"  given property of the account, e.g. UserName or Address
+  b64enc                             base64 encoding
+  json                               JSON encoding
+  quote                              double-quoted Go string`,
+		Example: `  cac render test -t app.properties.tmpl
+  where app.properties.tmpl contains:
+    db.user={{ cyberarkField "MY_DB" "UserName" }}
+    db.password={{ cyberark "MY_DB" | b64enc }}`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runRender(cmd.Context(), args, params)
+		},
+		ValidArgsFunction: completeConfig,
+	}
+
+	result.Flags().StringVarP(&params.Template, templateName, "t", "", "Go template file")
+	_ = result.MarkFlagRequired(templateName)
+	_ = result.MarkFlagFilename(templateName)
+
+	addCacheFlags(result, &params)
+	addDeadlineFlag(result, &params)
+
+	return result
+}
+
+func runRender(ctx context.Context, args []string, params internal.Parameters) error {
+	var err error
+
+	params.CfgName = args[0]
+
+	params.Config, err = ccp.LoadConfig(params.CfgName)
+	if err != nil {
+		return err
+	}
+
+	params.LoadConfig = ccp.LoadConfig
+
+	if err = params.Validate(); err != nil {
+		return err
+	}
+
+	client, err := internal.NewClient(params)
+	if err != nil {
+		return err
+	}
+
+	return client.Render(ctx)
+}
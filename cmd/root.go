@@ -1,13 +1,23 @@
 package cmd
 
 import (
+	"context"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/spf13/cobra"
 )
 
 func Execute() {
-	if err := newRootCommand().Execute(); err != nil {
+	// accounts being fetched are failed on interrupt, exec forwarding signals to its command
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+
+	err := newRootCommand().ExecuteContext(ctx)
+
+	stop()
+
+	if err != nil {
 		os.Exit(1)
 	}
 }
@@ -25,7 +35,9 @@ func newRootCommand() *cobra.Command {
 	result.AddCommand(
 		newCacheCommand(),
 		newConfigCommand(),
+		newExecCommand(),
 		newGetCommand(),
+		newRenderCommand(),
 		newVersionCommand(),
 	)
 
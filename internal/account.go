@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -8,9 +9,10 @@ import (
 	"time"
 )
 
-type successBody struct {
-	Content string `json:"Content"` //nolint:tagliatelle
-}
+const contentProperty = "Content"
+
+// successBody holds every property returned by CCP, the password being the Content one.
+type successBody map[string]any
 
 type errorBody struct {
 	ErrorCode string `json:"ErrorCode"` //nolint:tagliatelle
@@ -18,47 +20,119 @@ type errorBody struct {
 }
 
 type Account struct {
-	Object              string    `json:"object"`
-	Value               string    `json:"value"`
-	Try                 int       `json:"try"`
-	Error               error     `json:"error,omitempty"`
-	StatusCode          int       `json:"statusCode"`
-	Timestamp           time.Time `json:"timestamp"`
-	key, prefix, suffix string
+	Object       string            `json:"object"`
+	Value        string            `json:"value"`
+	Properties   map[string]string `json:"properties,omitempty"`
+	Try          int               `json:"try"`
+	Error        error             `json:"error,omitempty"`
+	StatusCode   int               `json:"statusCode"`
+	Timestamp    time.Time         `json:"timestamp"`
+	Stale        bool              `json:"stale,omitempty"`
+	Host         string            `json:"host,omitempty"`
+	Hits         int               `json:"-"`
+	AccessedAt   time.Time         `json:"-"`
+	errorCode    string
+	expiresAt    time.Time
+	fromCache    bool
+	lastKnown    *Account
+	latency      time.Duration
+	lock         *fileLock
+	ref          reference
+	reserved     bool // a request was allowed by the rate limit before locking the account
+	retryAfter   time.Duration
+	placeholders []placeholder
 }
 
-func newAccount(object string, now time.Time, key, prefix, suffix string) *Account {
+func newAccount(object string, now time.Time) *Account {
+	ref, err := parseReference(object)
+
 	return &Account{
 		Object:    object,
+		Error:     err,
+		Timestamp: now,
+		ref:       ref,
+	}
+}
+
+// newPlaceholderAccount returns the account referenced by placeholders, possibly of another configuration.
+func newPlaceholderAccount(s string, now time.Time) *Account {
+	ref, err := parsePlaceholderReference(s)
+
+	return &Account{
+		Object:    s,
+		Error:     err,
+		Timestamp: now,
+		ref:       ref,
+	}
+}
+
+// renew returns a new request of the account, to fetch it again.
+func (acct *Account) renew(now time.Time) *Account {
+	return &Account{
+		Object:    acct.Object,
+		Error:     acct.ref.validate(acct.Object),
 		Timestamp: now,
-		key:       key,
-		prefix:    prefix,
-		suffix:    suffix,
+		ref:       acct.ref,
 	}
 }
 
 func (acct *Account) newTry() {
 	acct.Try++
+	acct.reset()
+}
+
+// reset clears the result of a request, before sending it again.
+func (acct *Account) reset() {
 	acct.Error = nil
 	acct.StatusCode = 0
+	acct.errorCode = ""
+	acct.retryAfter = 0
 }
 
-func (acct *Account) retry(maxTries int) bool {
-	if acct.Try >= maxTries {
-		return false
-	}
+// useCached takes the value of the given cached account, stale if expired.
+func (acct *Account) useCached(cached Account, now time.Time) {
+	acct.Error = nil
+	acct.StatusCode = cached.StatusCode
+	acct.Timestamp = cached.Timestamp
+	acct.Value = cached.Value
+	acct.Properties = cached.Properties
+	acct.Stale = !now.Before(cached.expiresAt)
+	acct.Host = cached.Host
+	acct.expiresAt = cached.expiresAt
+}
 
-	return acct.StatusCode == 0 ||
-		acct.StatusCode == http.StatusInternalServerError ||
-		acct.StatusCode == http.StatusBadGateway ||
-		acct.StatusCode == http.StatusServiceUnavailable ||
-		acct.StatusCode == http.StatusGatewayTimeout
+// serverFailure tells whether CyberArk could not be reached or failed, rather than rejected the request.
+func (acct *Account) serverFailure() bool {
+	return acct.StatusCode == 0 || acct.StatusCode >= http.StatusInternalServerError
 }
 
 func (acct *Account) ok() bool {
 	return acct.Error == nil && acct.StatusCode == http.StatusOK
 }
 
+// failed tells whether the account is in error or, if referenced by placeholders, whether at least one of them
+// cannot be resolved: the account or its property is missing, without default value.
+func (acct *Account) failed() bool {
+	if len(acct.placeholders) == 0 {
+		return !acct.ok()
+	}
+
+	return len(acct.unresolved()) > 0
+}
+
+// unresolved returns the placeholders of the account that cannot be resolved.
+func (acct *Account) unresolved() []placeholder {
+	var result []placeholder
+
+	for _, p := range acct.placeholders {
+		if _, ok := p.value(acct); !ok {
+			result = append(result, p)
+		}
+	}
+
+	return result
+}
+
 func (acct *Account) parseError(data []byte) {
 	var result *errorBody
 
@@ -66,6 +140,7 @@ func (acct *Account) parseError(data []byte) {
 		acct.Error = NewError(nil, "failed to parse JSON '%s'", string(data))
 	} else {
 		acct.Error = NewError(nil, "%s: %s", result.ErrorCode, result.ErrorMsg)
+		acct.errorCode = result.ErrorCode
 	}
 }
 
@@ -74,17 +149,62 @@ func (acct *Account) parseSuccess(data []byte) {
 
 	if err := parseBody(data, &result); err != nil {
 		acct.Error = NewError(nil, "failed to parse JSON '%s'", string(data))
-	} else {
-		acct.Value = strings.Trim(result.Content, "'\"")
+
+		return
+	}
+
+	acct.Properties = make(map[string]string, len(*result))
+
+	for name, value := range *result {
+		if name == contentProperty {
+			acct.Value = propertyValue(value)
+		} else {
+			acct.Properties[name] = propertyValue(value)
+		}
 	}
 }
 
-func (acct *Account) shell(fromStdin bool) string {
-	if fromStdin {
-		return strings.Join([]string{acct.key, "=", acct.prefix, acct.Value, acct.suffix}, "")
+// propertyValue returns strings as is and other values as JSON, e.g. numbers as returned by CCP.
+func propertyValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+
+	return string(data)
+}
+
+// lookup returns the value of the given CCP property, the password for Content or an empty name.
+func (acct *Account) lookup(name string) (string, bool) {
+	if name == "" || strings.EqualFold(name, contentProperty) {
+		return acct.Value, true
 	}
 
-	return fmt.Sprintf("%s='%s'", acct.Object, acct.Value)
+	for key, value := range acct.Properties {
+		if strings.EqualFold(key, name) {
+			return value, true
+		}
+	}
+
+	return "", false
+}
+
+func (acct *Account) property(name string) string {
+	result, _ := acct.lookup(name)
+
+	return result
+}
+
+// propertyName returns the name used to output the given property, e.g. KEY_UserName.
+func propertyName(name, property string) string {
+	return name + "_" + property
 }
 
 func (acct *Account) String() string {
@@ -92,5 +212,17 @@ func (acct *Account) String() string {
 }
 
 func parseBody[T any](data []byte, result *T) error {
-	return json.Unmarshal(data, &result)
+	decoder := json.NewDecoder(bytes.NewReader(data))
+
+	decoder.UseNumber()
+
+	if err := decoder.Decode(&result); err != nil {
+		return err
+	}
+
+	if decoder.More() {
+		return NewError(nil, "unexpected data after JSON")
+	}
+
+	return nil
 }
@@ -130,7 +130,7 @@ func Test_account_parseSuccess(t *testing.T) {
 			args: args{
 				data: []byte(`{"Content": "'value'"}`),
 			},
-			wantValue: "value",
+			wantValue: "'value'",
 		},
 		{
 			name: "double quote",
@@ -138,7 +138,7 @@ func Test_account_parseSuccess(t *testing.T) {
 			args: args{
 				data: []byte(`{"Content": "\"value\""}`),
 			},
-			wantValue: "value",
+			wantValue: "\"value\"",
 		},
 	}
 
@@ -151,65 +151,105 @@ func Test_account_parseSuccess(t *testing.T) {
 	}
 }
 
-func Test_account_retry(t *testing.T) {
+func Test_account_parseSuccess_properties(t *testing.T) {
+	acct := &Account{}
+
+	acct.parseSuccess([]byte(`{
+		"Content": "value",
+		"UserName": "user",
+		"Address": "address",
+		"PasswordChangeInProgress": "false",
+		"CustomProperty": true,
+		"Port": 12345678901234567890,
+		"Ratio": 0.1,
+		"Nested": {"Key": "value", "Count": 2},
+		"Empty": null
+	}`))
+
+	require.NoError(t, acct.Error)
+	assert.Equal(t, "value", acct.Value)
+	assert.Equal(
+		t,
+		map[string]string{
+			"UserName":                 "user",
+			"Address":                  "address",
+			"PasswordChangeInProgress": "false",
+			"CustomProperty":           "true",
+			"Port":                     "12345678901234567890",
+			"Ratio":                    "0.1",
+			"Nested":                   `{"Count":2,"Key":"value"}`,
+			"Empty":                    "",
+		},
+		acct.Properties,
+	)
+}
+
+func Test_account_property(t *testing.T) {
+	acct := &Account{
+		Value:      "value",
+		Properties: map[string]string{"UserName": "user"},
+	}
+
+	assert.Equal(t, "value", acct.property(""))
+	assert.Equal(t, "value", acct.property("content"))
+	assert.Equal(t, "user", acct.property("username"))
+	assert.Equal(t, "", acct.property("Address"))
+}
+
+func Test_account_failed(t *testing.T) {
 	tests := []struct {
 		name string
 		acct *Account
 		want bool
 	}{
 		{
-			name: "200",
-			acct: &Account{
-				StatusCode: 200,
-				Try:        1,
-			},
+			name: "ok",
+			acct: &Account{StatusCode: 200},
 			want: false,
 		},
 		{
-			name: "500",
-			acct: &Account{
-				StatusCode: 500,
-				Try:        1,
-			},
+			name: "error",
+			acct: &Account{StatusCode: 404},
 			want: true,
 		},
 		{
-			name: "502",
+			name: "error with defaults",
 			acct: &Account{
-				StatusCode: 502,
-				Try:        2,
+				StatusCode:   404,
+				placeholders: []placeholder{{fallback: ptr("")}, {fallback: ptr("default")}},
 			},
-			want: true,
+			want: false,
 		},
 		{
-			name: "503",
+			name: "error without some default",
 			acct: &Account{
-				StatusCode: 503,
-				Try:        3,
+				StatusCode:   404,
+				placeholders: []placeholder{{fallback: ptr("default")}, {}},
 			},
 			want: true,
 		},
 		{
-			name: "504",
+			name: "ok with properties",
 			acct: &Account{
-				StatusCode: 504,
-				Try:        4,
+				StatusCode:   200,
+				Properties:   map[string]string{"UserName": "admin"},
+				placeholders: []placeholder{{}, {property: "UserName"}, {property: "Address", fallback: ptr("localhost")}},
 			},
-			want: true,
+			want: false,
 		},
 		{
-			name: "504",
+			name: "ok without some property",
 			acct: &Account{
-				StatusCode: 504,
-				Try:        5,
+				StatusCode:   200,
+				placeholders: []placeholder{{}, {property: "Adress"}},
 			},
-			want: false,
+			want: true,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			assert.Equal(t, tt.want, tt.acct.retry(5))
+			assert.Equal(t, tt.want, tt.acct.failed())
 		})
 	}
 }
@@ -217,11 +257,18 @@ func Test_account_retry(t *testing.T) {
 func Test_newAccount(t *testing.T) {
 	assert.Equal(
 		t,
-		&Account{Object: "object", Timestamp: now},
-		newAccount("object", now, "", "", ""),
+		&Account{Object: "object", Timestamp: now, ref: reference{name: "object", object: "object"}},
+		newAccount("object", now),
 	)
 }
 
+func Test_newAccount_invalidReference(t *testing.T) {
+	acct := newAccount("object?Unknown=value", now)
+
+	require.Error(t, acct.Error)
+	assert.Equal(t, "object?Unknown=value", acct.Object)
+}
+
 func Test_parseBody(t *testing.T) {
 	type args[T any] struct {
 		data   []byte
@@ -243,6 +290,14 @@ func Test_parseBody(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "trailing data",
+			args: args[successBody]{
+				data:   []byte("{\"Content\": \"value\"} {}"),
+				result: &successBody{},
+			},
+			wantErr: true,
+		},
 		{
 			name: "ok",
 			args: args[successBody]{
@@ -259,44 +314,3 @@ func Test_parseBody(t *testing.T) {
 		})
 	}
 }
-
-func Test_account_shell(t *testing.T) {
-	type args struct {
-		fromStdin bool
-	}
-
-	tests := []struct {
-		name string
-		acct *Account
-		args args
-		want string
-	}{
-		{
-			name: "from params",
-			acct: &Account{
-				Object: "object",
-				Value:  "value",
-			},
-			args: args{fromStdin: false},
-			want: "object='value'",
-		},
-		{
-			name: "from stdin",
-			acct: &Account{
-				Object: "object",
-				Value:  "value",
-				key:    "key",
-				prefix: "prefix_",
-				suffix: "_suffix",
-			},
-			args: args{fromStdin: true},
-			want: "key=prefix_value_suffix",
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			assert.Equalf(t, tt.want, tt.acct.shell(tt.args.fromStdin), "shell(%v)", tt.args.fromStdin)
-		})
-	}
-}
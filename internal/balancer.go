@@ -0,0 +1,101 @@
+package internal
+
+import (
+	"cmp"
+	"slices"
+	"sync"
+	"time"
+)
+
+const defaultHostCooldown = 30 * time.Second
+
+// balancer spreads the requests of a configuration over its CCP hosts: round-robin between the healthy hosts of
+// the best priority, failing over to the next priorities. A host failing is left aside for a cool-down period.
+type balancer struct {
+	cooldown  time.Duration
+	hosts     []prioritizedHost
+	mutex     sync.Mutex
+	next      int
+	unhealthy map[string]time.Time
+}
+
+type prioritizedHost struct {
+	name     string
+	priority int
+}
+
+func newBalancer(cfg Config) *balancer {
+	result := &balancer{
+		cooldown:  cfg.HostCooldown,
+		unhealthy: make(map[string]time.Time),
+	}
+
+	if result.cooldown == 0 {
+		result.cooldown = defaultHostCooldown
+	}
+
+	if _, found := cfg.Hosts[cfg.Host]; cfg.Host != "" && !found {
+		result.hosts = append(result.hosts, prioritizedHost{name: cfg.Host})
+	}
+
+	for name, priority := range cfg.Hosts {
+		result.hosts = append(result.hosts, prioritizedHost{name: name, priority: priority})
+	}
+
+	slices.SortFunc(result.hosts, func(a, b prioritizedHost) int {
+		return cmp.Or(cmp.Compare(a.priority, b.priority), cmp.Compare(a.name, b.name))
+	})
+
+	return result
+}
+
+// candidates returns the hosts to send a request to, by order of preference: healthy hosts by priority,
+// rotating between the ones of a same priority, then unhealthy hosts, the ones recovering first before.
+func (b *balancer) candidates(now time.Time) []string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	var healthy, unhealthy []string
+
+	for i := 0; i < len(b.hosts); {
+		j := i + 1
+
+		for j < len(b.hosts) && b.hosts[j].priority == b.hosts[i].priority {
+			j++
+		}
+
+		group := b.hosts[i:j]
+
+		for k := range group {
+			host := group[(b.next+k)%len(group)].name
+
+			if now.Before(b.unhealthy[host]) {
+				unhealthy = append(unhealthy, host)
+			} else {
+				healthy = append(healthy, host)
+			}
+		}
+
+		i = j
+	}
+
+	b.next++
+
+	slices.SortStableFunc(unhealthy, func(x, y string) int {
+		return b.unhealthy[x].Compare(b.unhealthy[y])
+	})
+
+	return append(healthy, unhealthy...)
+}
+
+// report marks the host unhealthy until the end of the cool-down if it failed, healthy otherwise.
+func (b *balancer) report(host string, failed bool, now time.Time) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if failed {
+		b.unhealthy[host] = now.Add(b.cooldown)
+	} else {
+		delete(b.unhealthy, host)
+	}
+}
@@ -0,0 +1,42 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_newBalancer(t *testing.T) {
+	b := newBalancer(Config{Host: "main", Hosts: map[string]int{"eu2": 1, "eu1": 1, "us": 2}})
+
+	assert.Equal(t, defaultHostCooldown, b.cooldown)
+	assert.Equal(
+		t,
+		[]prioritizedHost{{name: "main"}, {name: "eu1", priority: 1}, {name: "eu2", priority: 1}, {name: "us", priority: 2}},
+		b.hosts,
+	)
+
+	b = newBalancer(Config{Host: "main", HostCooldown: time.Minute, Hosts: map[string]int{"main": 3}})
+
+	assert.Equal(t, time.Minute, b.cooldown)
+	assert.Equal(t, []prioritizedHost{{name: "main", priority: 3}}, b.hosts, "host given a priority")
+}
+
+func Test_balancer_candidates(t *testing.T) {
+	b := newBalancer(Config{Hosts: map[string]int{"eu1": 1, "eu2": 1, "us": 2}})
+
+	assert.Equal(t, []string{"eu1", "eu2", "us"}, b.candidates(now))
+	assert.Equal(t, []string{"eu2", "eu1", "us"}, b.candidates(now), "round-robin")
+	assert.Equal(t, []string{"eu1", "eu2", "us"}, b.candidates(now), "round-robin")
+
+	b.report("eu1", true, now)
+	b.report("eu2", true, now.Add(time.Second))
+
+	assert.Equal(t, []string{"us", "eu1", "eu2"}, b.candidates(now), "failover, recovering first before")
+
+	b.report("eu2", false, now)
+
+	assert.Equal(t, []string{"eu2", "us", "eu1"}, b.candidates(now), "healthy again")
+	assert.Equal(t, []string{"eu2", "eu1", "us"}, b.candidates(now.Add(defaultHostCooldown)), "cool-down ended")
+}
@@ -0,0 +1,77 @@
+package internal
+
+import (
+	"sync"
+	"time"
+)
+
+const defaultBreakerCooldown = 30 * time.Second
+
+// breaker is a circuit breaker of a configuration: after threshold consecutive failures, it opens so that the
+// remaining accounts fail fast instead of being tried against a dead server. Once the cool-down is over,
+// a single request is let through, closing it again if successful.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+	mutex     sync.Mutex
+	failures  int
+	openUntil time.Time
+}
+
+func newBreaker(cfg Config) *breaker {
+	result := &breaker{
+		threshold: cfg.BreakerThreshold,
+		cooldown:  cfg.BreakerCooldown,
+	}
+
+	if result.cooldown == 0 {
+		result.cooldown = defaultBreakerCooldown
+	}
+
+	return result
+}
+
+// allow tells whether a request can be sent.
+func (b *breaker) allow(now time.Time) bool {
+	if b.threshold <= 0 {
+		return true
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.failures < b.threshold {
+		return true
+	}
+
+	if now.Before(b.openUntil) {
+		return false
+	}
+
+	// half-open, other requests waiting for the result of this one
+	b.openUntil = now.Add(b.cooldown)
+
+	return true
+}
+
+// report records the result of a request, opening the breaker on too many consecutive failures.
+func (b *breaker) report(failed bool, now time.Time) {
+	if b.threshold <= 0 {
+		return
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if !failed {
+		b.failures = 0
+
+		return
+	}
+
+	b.failures++
+
+	if b.failures >= b.threshold {
+		b.openUntil = now.Add(b.cooldown)
+	}
+}
@@ -0,0 +1,47 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_breaker(t *testing.T) {
+	b := newBreaker(Config{BreakerThreshold: 2})
+
+	assert.Equal(t, defaultBreakerCooldown, b.cooldown)
+	assert.True(t, b.allow(now))
+
+	b.report(true, now)
+	b.report(false, now)
+	b.report(true, now)
+
+	assert.True(t, b.allow(now), "failures not consecutive")
+
+	b.report(true, now)
+
+	assert.False(t, b.allow(now), "open")
+	assert.False(t, b.allow(now.Add(time.Second)), "open")
+	assert.True(t, b.allow(now.Add(defaultBreakerCooldown)), "half-open")
+	assert.False(t, b.allow(now.Add(defaultBreakerCooldown)), "single request while half-open")
+
+	b.report(true, now.Add(defaultBreakerCooldown))
+
+	assert.False(t, b.allow(now.Add(defaultBreakerCooldown+time.Second)), "open again")
+
+	b.report(false, now.Add(2*defaultBreakerCooldown))
+
+	assert.True(t, b.allow(now.Add(2*defaultBreakerCooldown)), "closed")
+	assert.True(t, b.allow(now.Add(2*defaultBreakerCooldown)), "closed")
+}
+
+func Test_breaker_disabled(t *testing.T) {
+	b := newBreaker(Config{})
+
+	for range 10 {
+		b.report(true, now)
+	}
+
+	assert.True(t, b.allow(now))
+}
@@ -0,0 +1,144 @@
+package internal
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// BundlePassphraseEnv holds the passphrase the key of exported bundles is derived from,
+	// taking precedence over key files.
+	BundlePassphraseEnv = "CAC_BUNDLE_PASSPHRASE"
+
+	bundleVersion = 1
+)
+
+// Bundle holds the cached accounts of a configuration, exported to be imported into the cache of another machine.
+type Bundle struct {
+	Config   string
+	accounts []Account
+}
+
+// bundleFile is the content of an exported bundle: its accounts are encrypted with a key derived from the salt,
+// the version, configuration and salt being authenticated with them so that any change is detected on import.
+// Not being signed, a bundle can be forged by anyone holding the key to import it.
+type bundleFile struct {
+	Version int    `json:"version"`
+	Config  string `json:"config"`
+	Salt    []byte `json:"salt"`
+	Data    string `json:"data"`
+}
+
+// bundleAccount is an exported account, with its expiry.
+type bundleAccount struct {
+	Name       string            `json:"name"`
+	Value      string            `json:"value"`
+	Properties map[string]string `json:"properties,omitempty"`
+	Host       string            `json:"host,omitempty"`
+	CreatedAt  int64             `json:"createdAt"`
+	ExpiresAt  int64             `json:"expiresAt"`
+}
+
+func NewBundle(config string, accounts []Account) Bundle {
+	return Bundle{Config: config, accounts: accounts}
+}
+
+// Len returns the number of accounts of the bundle.
+func (b Bundle) Len() int {
+	return len(b.accounts)
+}
+
+// Write encrypts the bundle with a key derived from the given source.
+func (b Bundle) Write(w io.Writer, source KeySource) error {
+	salt, err := newSalt()
+	if err != nil {
+		return err
+	}
+
+	key, err := source.derive(salt)
+	if err != nil {
+		return err
+	}
+
+	accounts := make([]bundleAccount, len(b.accounts))
+
+	for i, acct := range b.accounts {
+		accounts[i] = bundleAccount{
+			Name:       acct.Object,
+			Value:      acct.Value,
+			Properties: acct.Properties,
+			Host:       acct.Host,
+			CreatedAt:  acct.Timestamp.Unix(),
+			ExpiresAt:  acct.expiresAt.Unix(),
+		}
+	}
+
+	plaintext, err := json.Marshal(accounts)
+	if err != nil {
+		return err
+	}
+
+	result := bundleFile{Version: bundleVersion, Config: b.Config, Salt: salt}
+
+	if result.Data, err = key.seal(string(plaintext), result.aad()); err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(result)
+}
+
+// ReadBundle decrypts a bundle with a key derived from the given source, failing if it was modified.
+func ReadBundle(r io.Reader, source KeySource) (Bundle, error) {
+	var file bundleFile
+
+	if err := json.NewDecoder(r).Decode(&file); err != nil {
+		return Bundle{}, NewError(err, "invalid bundle")
+	}
+
+	if file.Version != bundleVersion {
+		return Bundle{}, NewError(nil, "unsupported bundle version %d", file.Version)
+	}
+
+	key, err := source.derive(file.Salt)
+	if err != nil {
+		return Bundle{}, err
+	}
+
+	plaintext, err := key.open(file.Data, file.aad())
+	if err != nil {
+		return Bundle{}, NewError(err, "failed to decrypt bundle, either it was modified or the key is wrong")
+	}
+
+	var accounts []bundleAccount
+
+	if err = json.Unmarshal([]byte(plaintext), &accounts); err != nil {
+		return Bundle{}, NewError(err, "invalid bundle")
+	}
+
+	result := Bundle{Config: file.Config, accounts: make([]Account, len(accounts))}
+
+	for i, ba := range accounts {
+		acct := newAccount(ba.Name, time.Unix(ba.CreatedAt, 0))
+
+		acct.Value = ba.Value
+		acct.Properties = ba.Properties
+		acct.Host = ba.Host
+		acct.StatusCode = http.StatusOK
+		acct.expiresAt = time.Unix(ba.ExpiresAt, 0)
+
+		result.accounts[i] = *acct
+	}
+
+	return result, nil
+}
+
+// aad returns the additional data authenticating the header of the bundle.
+func (f bundleFile) aad() string {
+	return aad(f.Config, string(f.Salt), "bundle "+strconv.Itoa(f.Version))
+}
@@ -0,0 +1,91 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestBundle(t *testing.T, source KeySource) []byte {
+	t.Helper()
+
+	stale := newCachedAccount("o2", "value2")
+	stale.expiresAt = now.Add(-time.Hour)
+
+	buf := &bytes.Buffer{}
+
+	require.NoError(t, NewBundle("test", []Account{newCachedAccount("o1", "value1"), stale}).Write(buf, source))
+	assert.NotContains(t, buf.String(), "value1")
+
+	return buf.Bytes()
+}
+
+func TestReadBundle(t *testing.T) {
+	source := KeySource{Passphrase: "bundle passphrase"}
+
+	bundle, err := ReadBundle(bytes.NewReader(newTestBundle(t, source)), source)
+	require.NoError(t, err)
+	assert.Equal(t, "test", bundle.Config)
+	require.Equal(t, 2, bundle.Len())
+	assert.Equal(t, "value1", bundle.accounts[0].Value)
+	assert.Equal(t, map[string]string{"UserName": "user of o1"}, bundle.accounts[0].Properties)
+	assert.True(t, bundle.accounts[0].ok())
+	assert.Equal(t, now.Add(time.Hour), bundle.accounts[0].expiresAt.UTC())
+	assert.Equal(t, now.Add(-time.Hour), bundle.accounts[1].expiresAt.UTC())
+
+	_, err = ReadBundle(bytes.NewReader(newTestBundle(t, source)), KeySource{Passphrase: "other"})
+	require.Error(t, err, "wrong key")
+	assert.ErrorContains(t, err, "message authentication failed", "cause kept")
+}
+
+func TestReadBundle_tampered(t *testing.T) {
+	source := KeySource{File: newTestKeyFile(t)}
+
+	for name, tamper := range map[string]func(f *bundleFile){
+		"config": func(f *bundleFile) { f.Config = "other" },
+		"salt":   func(f *bundleFile) { f.Salt[0]++ },
+		"data": func(f *bundleFile) {
+			data := []byte(f.Data)
+			data[len(data)/2] ^= 1
+			f.Data = string(data)
+		},
+		"version": func(f *bundleFile) { f.Version++ },
+	} {
+		t.Run(name, func(t *testing.T) {
+			var file bundleFile
+
+			require.NoError(t, json.Unmarshal(newTestBundle(t, source), &file))
+
+			tamper(&file)
+
+			data, err := json.Marshal(file)
+			require.NoError(t, err)
+
+			_, err = ReadBundle(bytes.NewReader(data), source)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestDBCache_Import(t *testing.T) {
+	cache := newTestCache(t)
+	source := KeySource{Passphrase: "bundle passphrase"}
+
+	bundle, err := ReadBundle(bytes.NewReader(newTestBundle(t, source)), source)
+	require.NoError(t, err)
+
+	require.Error(t, cache.Import(bundle), "locked")
+
+	require.NoError(t, cache.Unlock("test", KeySource{File: newTestKeyFile(t)}))
+	require.NoError(t, cache.Import(bundle))
+
+	accounts, err := cache.SortedAccounts("test", "", nil)
+	require.NoError(t, err)
+	require.Len(t, accounts, 2)
+	assert.Equal(t, "value2", accounts[1].Value)
+	assert.Equal(t, now.Add(-time.Hour), accounts[1].expiresAt.UTC())
+}
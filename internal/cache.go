@@ -0,0 +1,249 @@
+package internal
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	cacheBackendKeyring = "keyring"
+	cacheBackendMemory  = "memory"
+	cacheBackendNone    = "none"
+	cacheBackendSQLite  = "sqlite"
+)
+
+// Cache stores the accounts fetched from CyberArk by configuration, so that they are not fetched again before expiry.
+type Cache interface {
+	Close()
+	Configs(prefix string) ([]string, error)
+	Remove(config string, names ...string) error
+	RemoveAll(config string) error
+	SortedAccounts(config, prefix string, exclusions []string) ([]Account, error)
+	Unlock(config string, source KeySource) error
+
+	clean(config string, before time.Time) (int, error)
+	get(config, name string) (Account, error)
+	hit(config, name string, at time.Time) error
+	merge(defaultConfig string, accounts []Account) error
+}
+
+// CacheBackends returns the supported cache backends.
+func CacheBackends() []string {
+	return []string{cacheBackendKeyring, cacheBackendMemory, cacheBackendNone, cacheBackendSQLite}
+}
+
+// NewCache opens the given cache backend, SQLite by default.
+func NewCache(backend string) (Cache, error) {
+	switch backend {
+	case cacheBackendKeyring:
+		return NewKeyringCache()
+	case cacheBackendMemory:
+		return memoryCache{store: memory}, nil
+	case cacheBackendNone:
+		return noCache{}, nil
+	case "", cacheBackendSQLite:
+		return NewDBCache()
+	default:
+		return nil, NewError(nil, "unknown cache backend %q", backend)
+	}
+}
+
+// memoryStore holds the accounts cached in memory, shared by the clients of the process.
+type memoryStore struct {
+	accounts map[string]map[string]Account
+	mutex    sync.Mutex
+}
+
+//nolint:gochecknoglobals
+var memory = &memoryStore{accounts: make(map[string]map[string]Account)}
+
+// memoryCache keeps accounts for the life of the process only.
+type memoryCache struct {
+	store *memoryStore
+}
+
+func (c memoryCache) Close() {}
+
+func (c memoryCache) Configs(prefix string) ([]string, error) {
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+
+	var result []string
+
+	for config := range c.store.accounts {
+		if strings.HasPrefix(strings.ToLower(config), strings.ToLower(prefix)) {
+			result = append(result, config)
+		}
+	}
+
+	sort.Strings(result)
+
+	return result, nil
+}
+
+func (c memoryCache) Remove(config string, names ...string) error {
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+
+	for _, name := range names {
+		delete(c.store.accounts[config], name)
+	}
+
+	if len(c.store.accounts[config]) == 0 {
+		delete(c.store.accounts, config)
+	}
+
+	return nil
+}
+
+func (c memoryCache) RemoveAll(config string) error {
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+
+	delete(c.store.accounts, config)
+
+	return nil
+}
+
+func (c memoryCache) SortedAccounts(config, prefix string, exclusions []string) ([]Account, error) {
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+
+	var result []Account
+
+	for name, acct := range c.store.accounts[config] {
+		lowerName := strings.ToLower(name)
+
+		if (prefix == "" || strings.HasPrefix(lowerName, prefix)) &&
+			!ContainsFunc(exclusions, func(s string) bool {
+				return strings.ToLower(s) == lowerName
+			}) {
+			result = append(result, acct)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Object < result[j].Object
+	})
+
+	return result, nil
+}
+
+// Unlock does nothing, accounts never leaving the memory of the process.
+func (c memoryCache) Unlock(string, KeySource) error {
+	return nil
+}
+
+func (c memoryCache) clean(config string, before time.Time) (int, error) {
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+
+	result := 0
+
+	for name, acct := range c.store.accounts[config] {
+		if acct.expiresAt.Before(before) {
+			delete(c.store.accounts[config], name)
+
+			result++
+		}
+	}
+
+	if len(c.store.accounts[config]) == 0 {
+		delete(c.store.accounts, config)
+	}
+
+	return result, nil
+}
+
+func (c memoryCache) get(config, name string) (Account, error) {
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+
+	result, found := c.store.accounts[config][name]
+	if !found {
+		return result, NewError(nil, "%s not found in memory", name)
+	}
+
+	return result, nil
+}
+
+func (c memoryCache) hit(string, string, time.Time) error {
+	return nil
+}
+
+// merge caches the given accounts, under their own configuration if any or under the default one.
+func (c memoryCache) merge(defaultConfig string, accounts []Account) error {
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+
+	for _, acct := range accounts {
+		if !acct.ok() {
+			continue
+		}
+
+		config := acct.ref.config
+		if config == "" {
+			config = defaultConfig
+		}
+
+		if c.store.accounts[config] == nil {
+			c.store.accounts[config] = make(map[string]Account)
+		}
+
+		c.store.accounts[config][acct.ref.name] = Account{
+			Object:     acct.ref.name,
+			Value:      acct.Value,
+			Properties: acct.Properties,
+			Try:        acct.Try,
+			StatusCode: acct.StatusCode,
+			Timestamp:  acct.Timestamp,
+			Host:       acct.Host,
+			expiresAt:  acct.expiresAt,
+		}
+	}
+
+	return nil
+}
+
+// noCache always fetches accounts from CyberArk.
+type noCache struct{}
+
+func (c noCache) Close() {}
+
+func (c noCache) Configs(string) ([]string, error) {
+	return nil, nil
+}
+
+func (c noCache) Remove(string, ...string) error {
+	return nil
+}
+
+func (c noCache) RemoveAll(string) error {
+	return nil
+}
+
+func (c noCache) SortedAccounts(string, string, []string) ([]Account, error) {
+	return nil, nil
+}
+
+func (c noCache) Unlock(string, KeySource) error {
+	return nil
+}
+
+func (c noCache) clean(string, time.Time) (int, error) {
+	return 0, nil
+}
+
+func (c noCache) get(_, name string) (Account, error) {
+	return Account{}, NewError(nil, "%s not cached", name)
+}
+
+func (c noCache) hit(string, string, time.Time) error {
+	return nil
+}
+
+func (c noCache) merge(string, []Account) error {
+	return nil
+}
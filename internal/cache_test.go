@@ -0,0 +1,82 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewCache(t *testing.T) {
+	t.Setenv(xdgStateHome, t.TempDir())
+
+	for _, backend := range []string{"", cacheBackendMemory, cacheBackendNone, cacheBackendSQLite} {
+		cache, err := NewCache(backend)
+		require.NoError(t, err)
+
+		cache.Close()
+	}
+
+	_, err := NewCache("unknown")
+	require.Error(t, err)
+}
+
+func Test_memoryCache(t *testing.T) {
+	cache := memoryCache{store: &memoryStore{accounts: make(map[string]map[string]Account)}}
+
+	require.NoError(t, cache.merge("test", []Account{
+		newCachedAccount("o1", "value1"),
+		newCachedAccount("other/o1", "other value"),
+		*newAccount("o2", now),
+	}))
+
+	acct, err := cache.get("test", "o1")
+	require.NoError(t, err)
+	assert.Equal(t, "value1", acct.Value)
+
+	_, err = cache.get("test", "o2")
+	require.Error(t, err)
+
+	configs, err := cache.Configs("o")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"other"}, configs)
+
+	accounts, err := cache.SortedAccounts("other", "", nil)
+	require.NoError(t, err)
+	require.Len(t, accounts, 1)
+	assert.Equal(t, "other value", accounts[0].Value)
+
+	count, err := cache.clean("test", now.Add(2*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	_, err = cache.get("test", "o1")
+	require.Error(t, err)
+
+	_, err = cache.get("other", "o1")
+	require.NoError(t, err)
+
+	require.NoError(t, cache.merge("other", []Account{newCachedAccount("o2", "value2")}))
+	require.NoError(t, cache.Remove("other", "o1", "unknown"))
+
+	accounts, err = cache.SortedAccounts("other", "", nil)
+	require.NoError(t, err)
+	require.Len(t, accounts, 1)
+	assert.Equal(t, "o2", accounts[0].Object)
+
+	require.NoError(t, cache.RemoveAll("other"))
+
+	configs, err = cache.Configs("")
+	require.NoError(t, err)
+	assert.Empty(t, configs)
+}
+
+func Test_noCache(t *testing.T) {
+	cache := noCache{}
+
+	require.NoError(t, cache.merge("test", []Account{newCachedAccount("o1", "value1")}))
+
+	_, err := cache.get("test", "o1")
+	require.Error(t, err)
+}
@@ -1,161 +1,498 @@
 package internal
 
 import (
-	"bufio"
 	"context"
-	"crypto/tls"
 	"io"
 	"log"
+	"maps"
 	"net/http"
-	"net/url"
 	"os"
-	"regexp"
 	"sort"
-	"time"
-)
-
-var lineRegex = regexp.MustCompile(`^([^#][^=]*)=(.*)\$\{CYBERARK:(.+)}(.*)$`)
-
-const (
-	lineRegexGroups = 5
+	"strings"
+	"sync"
 )
 
 type Client struct {
-	clock  clock
-	http   *http.Client
-	log    *log.Logger // help testing
-	params Parameters
+	background *sync.WaitGroup
+	clock      clock
+	endpoints  map[string]endpoint
+	log        *log.Logger   // help testing
+	mutex      *sync.RWMutex // guards endpoints, added by concurrent fetches
+	params     Parameters
+	stats      *Stats
+	stdin      io.Reader // help testing
 }
 
 func NewClient(params Parameters) (Client, error) {
-	cert, err := tls.LoadX509KeyPair(params.CertFile, params.KeyFile)
+	return newClient(params, log.New(os.Stdout, "", 0), os.Stdin)
+}
+
+// NewQuietClient returns a client without console input nor output, e.g. for libraries.
+func NewQuietClient(params Parameters) (Client, error) {
+	return newClient(params, log.New(io.Discard, "", 0), strings.NewReader(""))
+}
+
+func newClient(params Parameters, l *log.Logger, stdin io.Reader) (Client, error) {
+	ep, err := newEndpoint(params.CfgName, params.Config, params.HTTPClient)
 	if err != nil {
 		return Client{}, err
 	}
 
 	return Client{
-		clock: utcClock{},
-		http: &http.Client{
-			Timeout: params.Timeout,
-			Transport: &http.Transport{
-				MaxConnsPerHost: params.MaxConns,
-				Proxy:           nil,
-				TLSClientConfig: &tls.Config{
-					Certificates:       []tls.Certificate{cert},
-					MinVersion:         tls.VersionTLS12,
-					Renegotiation:      tls.RenegotiateOnceAsClient,
-					InsecureSkipVerify: params.SkipVerify, //nolint:gosec
-				},
-			},
-		},
-		log:    log.New(os.Stdout, "", 0),
-		params: params,
+		background: &sync.WaitGroup{},
+		clock:      utcClock{},
+		endpoints:  map[string]endpoint{ep.name: ep},
+		log:        l,
+		mutex:      &sync.RWMutex{},
+		params:     params,
+		stats:      &Stats{},
+		stdin:      stdin,
 	}, nil
 }
 
-func (c Client) Run() error {
-	cache, err := NewDBCache()
+// Get fetches the accounts of the given queries, from the cache or from CyberArk, in the same order.
+// Accounts in error are returned with their error, the returned one counting them.
+func (c Client) Get(ctx context.Context, queries []Query) ([]Account, error) {
+	now := c.clock.now()
+	requests := make([]*Account, len(queries))
+
+	// sizes the pool
+	c.params.Objects = make([]string, len(queries))
+
+	for i, q := range queries {
+		requests[i] = q.newAccount(now)
+		c.params.Objects[i] = requests[i].Object
+	}
+
+	ctx, cancel := c.withDeadline(ctx)
+	defer cancel()
+
+	accounts, err := c.fetch(ctx, requests)
+	if err != nil {
+		return nil, err
+	}
+
+	c.wait()
+
+	byObject := accountsByObject(accounts)
+	result := make([]Account, len(queries))
+
+	for i, acct := range requests {
+		result[i] = *byObject[acct.Object]
+	}
+
+	return result, c.ok(accounts)
+}
+
+func (c Client) Run(ctx context.Context) error {
+	requests, tmpl, err := c.read()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := c.withDeadline(ctx)
+	defer cancel()
+
+	accounts, err := c.fetch(ctx, requests)
+	if err != nil {
+		return err
+	}
+
+	if err = c.output(accounts, tmpl); err != nil {
+		return err
+	}
+
+	if c.params.Stats && c.params.format() != formatJSON {
+		c.params.Errorf("%v", c.stats)
+	}
+
+	c.wait()
+
+	return c.ok(accounts)
+}
+
+// Refresh fetches again every cached account of the configuration, updating the cache,
+// and reports the accounts whose value changed and the failed ones.
+func (c Client) Refresh(ctx context.Context) error {
+	ctx, cancel := c.withDeadline(ctx)
+	defer cancel()
+
+	caches, _, err := c.openCaches()
+	if err != nil {
+		return err
+	}
+
+	defer closeCaches(caches)
+
+	cache := caches[c.params.cacheBackend()]
+
+	cached, err := cache.SortedAccounts(c.params.CfgName, "", nil)
 	if err != nil {
 		return err
 	}
 
-	defer cache.Close()
+	now := c.clock.now()
+	requests := make([]*Account, len(cached))
+	values := make(map[string]string, len(cached))
+
+	// sizes the pool
+	c.params.Objects = make([]string, len(cached))
+
+	for i, acct := range cached {
+		requests[i] = newAccount(acct.Object, now)
+		values[acct.Object] = acct.Value
+		c.params.Objects[i] = acct.Object
+	}
+
+	accounts := c.pool(ctx, caches, requests, false)
 
-	if err = cache.clean(c.clock, c.params.Expiry); err != nil {
+	if err = c.merge(caches, accounts); err != nil {
 		return err
 	}
 
+	changed := 0
+
+	for _, acct := range accounts {
+		switch {
+		case acct.failed():
+			c.log.Printf("%s: failed: %v", acct.Object, acct.Error)
+		case acct.Value != values[acct.Object]:
+			changed++
+
+			c.log.Printf("%s: changed", acct.Object)
+		}
+	}
+
+	c.log.Printf("%d account(s) refreshed, %d changed", len(accounts), changed)
+
+	return c.ok(accounts)
+}
+
+// fetch gets the requested accounts from the cache or from CyberArk, using a pool of workers.
+// Stale accounts are revalidated in background.
+func (c Client) fetch(ctx context.Context, requests []*Account) ([]Account, error) {
+	c.addEndpoints(requests)
+
+	caches, evictions, err := c.openCaches()
+	if err != nil {
+		return nil, err
+	}
+
+	defer closeCaches(caches)
+
+	accounts := c.pool(ctx, caches, requests, !c.params.NoCache && !c.params.Refresh)
+
+	if err = c.merge(caches, accounts); err != nil {
+		return nil, err
+	}
+
+	c.stats.record(accounts, evictions)
+
+	c.revalidate(ctx, accounts)
+
+	return accounts, nil
+}
+
+// pool gets the requested accounts using a pool of workers, reading the cache first if asked to.
+func (c Client) pool(ctx context.Context, caches map[string]Cache, requests []*Account, read bool) []Account {
 	size := c.poolSize()
 	in := make(chan *Account, size)
 	out := make(chan *Account, size)
 
 	for range size {
-		go c.worker(cache, in, out)
+		go c.worker(ctx, caches, read, in, out)
 	}
 
-	count := make(chan int)
-
-	go c.read(in, count)
+	go func() {
+		for _, acct := range requests {
+			in <- acct
+		}
+	}()
 
-	accounts := c.collect(out, count)
+	accounts := c.collect(out, len(requests))
 
 	close(in)
 
-	if err = c.output(accounts); err != nil {
-		return err
+	return accounts
+}
+
+// revalidate fetches again in background the stale accounts served from the cache, updating the cache.
+// Failures are only reported, the stale values being kept. Stale values used after a failed fetch are not
+// revalidated, CyberArk having just been tried.
+func (c Client) revalidate(ctx context.Context, accounts []Account) {
+	if c.params.Offline {
+		return
 	}
 
-	if err = cache.merge(c.params.CfgName, accounts); err != nil {
-		return err
+	var requests []*Account
+
+	for _, acct := range accounts {
+		if acct.Stale && acct.fromCache {
+			requests = append(requests, acct.renew(c.clock.now()))
+		}
 	}
 
-	return c.ok(accounts)
+	if len(requests) == 0 {
+		return
+	}
+
+	// endpoints may be added by a next fetch meanwhile
+	bg := c
+
+	c.mutex.RLock()
+	bg.endpoints = maps.Clone(c.endpoints)
+	c.mutex.RUnlock()
+
+	c.background.Add(1)
+
+	go func() {
+		defer c.background.Done()
+
+		caches, _, err := bg.openCaches()
+		if err != nil {
+			c.params.Errorf("Failed to revalidate stale accounts: %v", err)
+
+			return
+		}
+
+		defer closeCaches(caches)
+
+		if err = bg.merge(caches, bg.pool(ctx, caches, requests, false)); err != nil {
+			c.params.Errorf("Failed to revalidate stale accounts: %v", err)
+		}
+	}()
 }
 
-func (c Client) output(accounts []Account) error {
-	switch {
-	case c.params.JSON:
-		output, err := jsonOutput(accounts)
+// withDeadline returns a context canceled after the deadline of the run, if any.
+func (c Client) withDeadline(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.params.Deadline > 0 {
+		return context.WithTimeout(ctx, c.params.Deadline)
+	}
+
+	return context.WithCancel(ctx)
+}
+
+// wait waits for the stale accounts being revalidated in background.
+func (c Client) wait() {
+	c.background.Wait()
+}
+
+// openCaches opens the cache backend of every endpoint, unlocking the cache of its configuration
+// and evicting its expired accounts, whose count is returned.
+func (c Client) openCaches() (map[string]Cache, int, error) {
+	result := make(map[string]Cache)
+	evictions := 0
+
+	for _, ep := range c.endpointList() {
+		backend := ep.config.cacheBackend()
+
+		if c.params.NoCache {
+			result[backend] = noCache{}
+
+			continue
+		}
+
+		cache, found := result[backend]
+		if !found {
+			var err error
+
+			if cache, err = NewCache(backend); err != nil {
+				closeCaches(result)
+
+				return nil, 0, err
+			}
+
+			result[backend] = cache
+		}
+
+		if err := cache.Unlock(ep.name, c.keySource(ep)); err != nil {
+			closeCaches(result)
+
+			return nil, 0, NewError(err, "failed to unlock cache of %q", ep.name)
+		}
+
+		if c.params.Offline || c.params.FallbackToCache {
+			// expired accounts are kept as a last resort
+			continue
+		}
+
+		count, err := cache.clean(ep.name, c.clock.now().Add(ep.config.MaxStale*-1))
 		if err != nil {
+			closeCaches(result)
+
+			return nil, 0, err
+		}
+
+		evictions += count
+	}
+
+	return result, evictions, nil
+}
+
+// keySource returns the key source of the cache of the endpoint, the one of the parameters taking precedence.
+func (c Client) keySource(ep endpoint) KeySource {
+	if c.params.CacheKey != (KeySource{}) {
+		return c.params.CacheKey
+	}
+
+	return NewKeySource(ep.config)
+}
+
+func closeCaches(caches map[string]Cache) {
+	for _, cache := range caches {
+		cache.Close()
+	}
+}
+
+// merge caches every account in the cache backend of its configuration.
+func (c Client) merge(caches map[string]Cache, accounts []Account) error {
+	for backend, cache := range caches {
+		var backendAccounts []Account
+
+		for _, acct := range accounts {
+			if ep, found := c.endpoint(c.configName(acct.ref)); found && ep.config.cacheBackend() == backend {
+				backendAccounts = append(backendAccounts, acct)
+			}
+		}
+
+		if err := cache.merge(c.params.CfgName, backendAccounts); err != nil {
 			return err
 		}
+	}
+
+	return nil
+}
 
-		c.log.Print(output)
+func (c Client) output(accounts []Account, tmpl template) error {
+	switch {
 	case c.params.Output != "":
-		return fileOutput(accounts, c.params.Output)
+		return fileOutput(c.entries(accounts, tmpl), c.params.Output)
+	case c.params.fromStdin() && c.params.format() == formatShell:
+		_, err := io.WriteString(c.log.Writer(), tmpl.render(accountsByObject(accounts)))
+
+		return err
+	case c.params.Stats && c.params.format() == formatJSON:
+		return writeJSON(c.log.Writer(), struct {
+			Accounts []Account `json:"accounts"`
+			Stats    *Stats    `json:"stats"`
+		}{accounts, c.stats})
 	default:
-		c.log.Print(shellOutput(accounts, c.params.fromStdin()))
+		return formatters[c.params.format()](c.params).Format(c.log.Writer(), accounts, c.entries(accounts, tmpl))
 	}
+}
 
-	return nil
+func (c Client) entries(accounts []Account, tmpl template) []Entry {
+	if c.params.fromStdin() {
+		return templateEntries(tmpl, accountsByObject(accounts), c.params.Properties)
+	}
+
+	return accountEntries(accounts, c.params.Properties)
 }
 
-func (c Client) read(in chan<- *Account, count chan<- int) {
+func (c Client) read() ([]*Account, template, error) {
 	if c.params.fromStdin() {
-		count <- c.readFromReader(in, os.Stdin)
-	} else {
-		count <- c.readFromParams(in)
+		return c.readFromReader(c.stdin)
 	}
+
+	return c.readFromParams(), template{}, nil
 }
 
-func (c Client) readFromParams(in chan<- *Account) int {
+func (c Client) readFromParams() []*Account {
 	now := c.clock.now()
-	result := 0
+	result := make([]*Account, len(c.params.Objects))
 
-	for _, object := range c.params.Objects {
-		in <- newAccount(object, now, "", "", "")
-
-		result++
+	for i, object := range c.params.Objects {
+		result[i] = newAccount(object, now)
 	}
 
 	return result
 }
 
-func (c Client) readFromReader(in chan<- *Account, reader io.Reader) int {
-	now := c.clock.now()
-	scanner := bufio.NewScanner(reader)
-	result := 0
+func (c Client) readFromReader(reader io.Reader) ([]*Account, template, error) {
+	tmpl, err := parseTemplate(reader)
+	if err != nil {
+		return nil, tmpl, err
+	}
+
+	return tmpl.accounts(c.clock.now()), tmpl, nil
+}
+
+// addEndpoints creates the endpoints of the other configurations referenced by the accounts.
+func (c Client) addEndpoints(accounts []*Account) {
+	for _, acct := range accounts {
+		if acct.Error != nil {
+			continue
+		}
+
+		name := c.configName(acct.ref)
+		if _, found := c.endpoint(name); found {
+			continue
+		}
+
+		ep, err := c.newEndpoint(name)
+		if err != nil {
+			acct.Error = NewError(err, "failed to load config %q", name)
 
-	for scanner.Scan() {
-		line := scanner.Text()
-		groups := lineRegex.FindStringSubmatch(line)
+			continue
+		}
 
-		if len(groups) == lineRegexGroups {
-			in <- newAccount(groups[3], now, groups[1], groups[2], groups[4])
+		c.mutex.Lock()
 
-			result++
-		} else {
-			c.log.Print(line)
+		// added by a concurrent fetch meanwhile, keeping its connections and hosts health
+		if _, found := c.endpoints[name]; !found {
+			c.endpoints[name] = ep
 		}
+
+		c.mutex.Unlock()
+	}
+}
+
+func (c Client) endpoint(name string) (endpoint, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	ep, found := c.endpoints[name]
+
+	return ep, found
+}
+
+func (c Client) endpointList() []endpoint {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	result := make([]endpoint, 0, len(c.endpoints))
+
+	for _, ep := range c.endpoints {
+		result = append(result, ep)
 	}
 
 	return result
 }
 
-func (c Client) poolSize() int {
-	if !c.params.fromStdin() {
-		l := len(c.params.Objects)
+func (c Client) newEndpoint(name string) (endpoint, error) {
+	if c.params.LoadConfig == nil {
+		return endpoint{}, NewError(nil, "unknown config %q", name)
+	}
+
+	cfg, err := c.params.LoadConfig(name)
+	if err != nil {
+		return endpoint{}, err
+	}
 
+	return newEndpoint(name, cfg, c.params.HTTPClient)
+}
+
+// configName returns the name of the configuration of the given reference, the one of the run by default.
+func (c Client) configName(ref reference) string {
+	if ref.config == "" {
+		return c.params.CfgName
+	}
+
+	return ref.config
+}
+
+func (c Client) poolSize() int {
+	if l := len(c.params.Objects); l > 0 {
 		if c.params.MaxConns == 0 || l < c.params.MaxConns {
 			return l
 		}
@@ -164,18 +501,11 @@ func (c Client) poolSize() int {
 	return c.params.MaxConns
 }
 
-func (c Client) collect(accounts <-chan *Account, count <-chan int) []Account {
-	l := 0
-	lenKnown := false
-	results := make([]Account, 0)
+func (c Client) collect(accounts <-chan *Account, count int) []Account {
+	results := make([]Account, 0, count)
 
-	for !lenKnown || len(results) != l {
-		select {
-		case acct := <-accounts:
-			results = append(results, *acct)
-		case l = <-count:
-			lenKnown = true
-		}
+	for len(results) != count {
+		results = append(results, *<-accounts)
 	}
 
 	sort.Slice(results, func(i, j int) bool {
@@ -189,8 +519,16 @@ func (c Client) ok(accounts []Account) error {
 	errCount := 0
 
 	for _, acct := range accounts {
-		if !acct.ok() {
-			errCount++
+		if !acct.failed() {
+			continue
+		}
+
+		errCount++
+
+		if acct.ok() {
+			for _, p := range acct.unresolved() {
+				c.params.Errorf("Property %s of %s not found", p.property, acct.Object)
+			}
 		}
 	}
 
@@ -201,13 +539,59 @@ func (c Client) ok(accounts []Account) error {
 	return nil
 }
 
-func (c Client) worker(cache DBCache, in chan *Account, out chan<- *Account) {
+func (c Client) worker(ctx context.Context, caches map[string]Cache, read bool, in chan *Account, out chan<- *Account) {
 	for acct := range in {
-		if ca, err := cache.get(c.params.CfgName, acct.Object); err == nil {
-			acct.Error = nil
-			acct.StatusCode = ca.StatusCode
-			acct.Timestamp = ca.Timestamp
-			acct.Value = ca.Value
+		if acct.Error != nil && acct.Try == 0 {
+			c.params.Errorf("Failed to get %v", acct)
+
+			out <- acct
+
+			continue
+		}
+
+		if err := ctx.Err(); err != nil {
+			acct.Error = err
+			c.params.Errorf("Failed to get %v", acct)
+
+			out <- acct
+
+			continue
+		}
+
+		ep, found := c.endpoint(c.configName(acct.ref))
+		if !found {
+			acct.Error = NewError(nil, "unknown config %q", c.configName(acct.ref))
+			c.params.Errorf("Failed to get %v", acct)
+
+			out <- acct
+
+			continue
+		}
+
+		if c.params.Offline {
+			c.offline(caches[ep.config.cacheBackend()], ep, acct)
+
+			out <- acct
+
+			continue
+		}
+
+		if read && acct.Try == 0 && c.cachedOrLocked(ctx, caches[ep.config.cacheBackend()], ep, acct) {
+			out <- acct
+
+			continue
+		}
+
+		if !ep.breaker.allow(c.clock.now()) {
+			acct.Error = NewError(
+				nil,
+				"circuit breaker of config %q open after %d consecutive failures",
+				ep.name,
+				ep.config.BreakerThreshold,
+			)
+			c.params.Errorf("Failed to get %v", acct)
+			c.release(caches[ep.config.cacheBackend()], acct)
+			c.useStale(ep, acct)
 
 			out <- acct
 
@@ -216,49 +600,225 @@ func (c Client) worker(cache DBCache, in chan *Account, out chan<- *Account) {
 
 		acct.newTry()
 
-		c.get(acct)
+		start := c.clock.now()
+
+		c.failover(ctx, ep, acct)
+
+		acct.latency += c.clock.now().Sub(start)
+
+		if ctx.Err() == nil {
+			ep.breaker.report(acct.serverFailure(), c.clock.now())
+		}
+
+		if acct.ok() {
+			acct.expiresAt = acct.Timestamp.Add(ep.config.Expiry)
+		}
+
+		// never waiting while holding a lock, a process cannot wait for another one waiting for it
+		c.release(caches[ep.config.cacheBackend()], acct)
 
 		if !acct.ok() {
 			c.params.Errorf("Failed to get %v", acct)
 
-			if acct.retry(c.params.MaxTries) {
+			if policy := ep.config.retryPolicy(); policy.retry(acct) {
 				go func(acct *Account) {
-					time.Sleep(time.Duration(acct.Try*acct.Try) * c.params.Wait)
-					in <- acct
+					select {
+					case <-c.clock.after(policy.delay(acct)):
+						in <- acct
+					case <-ctx.Done():
+						acct.Error = ctx.Err()
+						out <- acct
+					}
 				}(acct)
 
 				continue
 			}
+
+			c.useStale(ep, acct)
 		}
 
 		out <- acct
 	}
 }
 
-func (c Client) url(values url.Values) *url.URL {
-	return &url.URL{
-		Scheme:   "https",
-		Host:     c.params.Host,
-		Path:     "/AIMWebService/api/Accounts",
-		RawQuery: values.Encode(),
+// cached tells whether the account could be taken from the cache: before its expiry, or until max-stale
+// when revalidated in background. Otherwise, the cached account is kept in case CyberArk fails.
+func (c Client) cached(cache Cache, ep endpoint, acct *Account) bool {
+	ca, err := cache.get(ep.name, acct.ref.name)
+	if err != nil {
+		return false
+	}
+
+	now := c.clock.now()
+
+	if now.Before(ca.expiresAt) ||
+		(ep.config.StaleWhileRevalidate && now.Before(ca.expiresAt.Add(ep.config.MaxStale))) {
+		acct.useCached(ca, now)
+		acct.fromCache = true
+
+		c.hit(cache, ep, acct)
+
+		return true
 	}
+
+	acct.lastKnown = &ca
+
+	return false
 }
 
-func (c Client) query(object string) url.Values {
-	result := url.Values{}
+// cachedOrLocked tells whether the account could be taken from the cache. Otherwise, if the cache is shared by
+// several processes, it locks the account so that a single one fetches it, the others waiting to read the cache.
+func (c Client) cachedOrLocked(ctx context.Context, cache Cache, ep endpoint, acct *Account) bool {
+	if c.cached(cache, ep, acct) {
+		return true
+	}
 
-	result.Set("AppID", c.params.AppID)
-	result.Set("Safe", c.params.Safe)
-	result.Set("Object", object)
+	if !ep.config.sharedCache() {
+		return false
+	}
 
-	return result
+	// waiting for the rate limit before holding the lock, the other processes waiting for it: only failing over
+	// to another host waits for it again meanwhile
+	if !c.throttle(ctx, ep) {
+		return false
+	}
+
+	acct.reserved = true
+
+	lock, err := lockAccount(ctx, ep.name, acct.ref.name)
+	if err != nil {
+		c.params.Errorf("Failed to lock %v: %v", acct, err)
+
+		return false
+	}
+
+	// fetched by another process meanwhile
+	if c.cached(cache, ep, acct) {
+		lock.unlock()
+
+		return true
+	}
+
+	acct.lock = &lock
+
+	return false
+}
+
+// release caches the fetched account before unlocking it, for the processes waiting to read it.
+func (c Client) release(cache Cache, acct *Account) {
+	if acct.lock == nil {
+		return
+	}
+
+	if err := cache.merge(c.params.CfgName, []Account{*acct}); err != nil {
+		c.params.Errorf("Failed to cache %v: %v", acct, err)
+	}
+
+	acct.lock.unlock()
+	acct.lock = nil
+}
+
+// offline takes the account from the cache only, even if expired.
+func (c Client) offline(cache Cache, ep endpoint, acct *Account) {
+	ca, err := cache.get(ep.name, acct.ref.name)
+	if err != nil {
+		acct.Error = NewError(err, "not cached")
+		c.params.Errorf("Failed to get %v", acct)
+
+		return
+	}
+
+	acct.useCached(ca, c.clock.now())
+	acct.fromCache = true
+
+	c.hit(cache, ep, acct)
+
+	if acct.Stale {
+		c.params.Errorf("Using stale value of %s expired at %v", acct.Object, ca.expiresAt)
+	}
+}
+
+// hit records that the cached account is used.
+func (c Client) hit(cache Cache, ep endpoint, acct *Account) {
+	if err := cache.hit(ep.name, acct.ref.name, c.clock.now()); err != nil {
+		c.params.Errorf("Failed to record hit of %v: %v", acct, err)
+	}
+}
+
+// useStale takes the last known value of a failed account if it expired less than max-stale ago or,
+// falling back to cache, if CyberArk could not be reached or failed.
+func (c Client) useStale(ep endpoint, acct *Account) {
+	if acct.lastKnown == nil {
+		return
+	}
+
+	if !c.clock.now().Before(acct.lastKnown.expiresAt.Add(ep.config.MaxStale)) &&
+		(!c.params.FallbackToCache || !acct.serverFailure()) {
+		return
+	}
+
+	c.params.Errorf("Using stale value of %s expired at %v: %v", acct.Object, acct.lastKnown.expiresAt, acct.Error)
+
+	acct.useCached(*acct.lastKnown, c.clock.now())
+}
+
+// failover gets the account from the hosts of the endpoint by order of preference, until one of them can be reached
+// and does not fail. The account records the host it was got from.
+func (c Client) failover(ctx context.Context, ep endpoint, acct *Account) {
+	hosts := ep.balancer.candidates(c.clock.now())
+
+	for i, host := range hosts {
+		if i > 0 {
+			c.params.Errorf("Failed to get %v from %s", acct, hosts[i-1])
+			acct.reset()
+		}
+
+		acct.Host = host
+
+		if acct.reserved {
+			acct.reserved = false
+		} else if !c.throttle(ctx, ep) {
+			acct.Error = ctx.Err()
+
+			return
+		}
+
+		c.get(ctx, ep, host, acct)
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		failed := acct.serverFailure()
+
+		ep.balancer.report(host, failed, c.clock.now())
+
+		if !failed {
+			return
+		}
+	}
+}
+
+// throttle waits for the rate limit of the endpoint to allow a request, telling false if canceled meanwhile.
+func (c Client) throttle(ctx context.Context, ep endpoint) bool {
+	delay := ep.limiter.reserve(c.clock.now())
+	if delay == 0 {
+		return true
+	}
+
+	select {
+	case <-c.clock.after(delay):
+		return true
+	case <-ctx.Done():
+		return false
+	}
 }
 
-func (c Client) get(acct *Account) {
+func (c Client) get(ctx context.Context, ep endpoint, host string, acct *Account) {
 	req, err := http.NewRequestWithContext(
-		context.Background(),
+		ctx,
 		http.MethodGet,
-		c.url(c.query(acct.Object)).String(),
+		ep.url(host, ep.query(acct.ref)).String(),
 		nil,
 	)
 	if err != nil {
@@ -267,7 +827,7 @@ func (c Client) get(acct *Account) {
 		return
 	}
 
-	response, err := c.http.Do(req)
+	response, err := ep.http.Do(req)
 	if err != nil {
 		acct.Error = err
 
@@ -281,6 +841,7 @@ func (c Client) get(acct *Account) {
 	}()
 
 	acct.StatusCode = response.StatusCode
+	acct.retryAfter = parseRetryAfter(response.Header.Get("Retry-After"), c.clock.now())
 
 	data, err := io.ReadAll(response.Body)
 	if err != nil {
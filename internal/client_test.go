@@ -2,18 +2,22 @@ package internal
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
-	_ "github.com/mattn/go-sqlite3"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -28,6 +32,7 @@ func newTestParameters(t *testing.T, ts *httptest.Server) Parameters {
 
 	result.AppID = "appId"
 	result.CfgName = "test"
+	result.Expiry = defaultExpiry
 	result.Host = u.Host
 	result.MaxTries = 2
 	result.Objects = []string{"o1", "o2"}
@@ -56,16 +61,87 @@ func newFixedClock() fixedClock {
 	}
 }
 
+// stuckClock never ends waiting.
+type stuckClock struct {
+	fixedClock
+}
+
+func (c stuckClock) after(time.Duration) <-chan time.Time {
+	return nil
+}
+
+// recordingClock records the delays waited for, without waiting.
+type recordingClock struct {
+	fixedClock
+
+	delays *[]time.Duration
+	mutex  *sync.Mutex
+}
+
+func (c recordingClock) after(d time.Duration) <-chan time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	*c.delays = append(*c.delays, d)
+
+	return c.fixedClock.after(d)
+}
+
+// callbackClock calls a function instead of waiting.
+type callbackClock struct {
+	fixedClock
+
+	callback func(d time.Duration)
+}
+
+func (c callbackClock) after(d time.Duration) <-chan time.Time {
+	c.callback(d)
+
+	return c.fixedClock.after(d)
+}
+
+// advancingClock is a fixed clock moved forward explicitly, without waiting.
+type advancingClock struct {
+	fixedClock
+
+	offset *atomic.Int64
+}
+
+func (c advancingClock) now() time.Time {
+	return c.t.Add(time.Duration(c.offset.Load()))
+}
+
+func newTestKeyFile(t *testing.T) string {
+	t.Helper()
+
+	result := filepath.Join(t.TempDir(), "cache.key")
+
+	require.NoError(t, os.WriteFile(result, []byte("test cache key"), rw))
+
+	return result
+}
+
 func newTestClient(t *testing.T, handler http.HandlerFunc) Client {
 	t.Helper()
 
 	ts := newTestServer(t, handler)
 
+	t.Setenv(xdgStateHome, t.TempDir())
+	t.Setenv(PassphraseEnv, "")
+
+	params := newTestParameters(t, ts)
+	params.CacheKeyFile = newTestKeyFile(t)
+
 	return Client{
-		clock:  newFixedClock(),
-		http:   ts.Client(),
+		background: &sync.WaitGroup{},
+		clock:      newFixedClock(),
+		endpoints: map[string]endpoint{
+			params.CfgName: newHTTPEndpoint(params.CfgName, params.Config, ts.Client()),
+		},
 		log:    log.New(io.Discard, "", 0),
-		params: newTestParameters(t, ts),
+		mutex:  &sync.RWMutex{},
+		params: params,
+		stats:  &Stats{},
 	}
 }
 
@@ -87,7 +163,7 @@ func TestClient_Run(t *testing.T) {
 	)
 	buf := captureOutput(client)
 
-	require.NoError(t, client.Run())
+	require.NoError(t, client.Run(context.Background()))
 	assert.Equal(t, "o1='value for o1'\no2='value for o2'\n", buf.String())
 }
 
@@ -102,25 +178,565 @@ func TestClient_Run_JSON(t *testing.T) {
 	client.params.JSON = true
 	buf := captureOutput(client)
 
-	require.NoError(t, client.Run())
+	require.NoError(t, client.Run(context.Background()))
 	assert.Equal(
 		t,
-		`[
+		fmt.Sprintf(`[
   {
     "object": "o1",
     "value": "value for o1",
     "try": 1,
     "statusCode": 200,
-    "timestamp": "2023-02-21T19:45:48Z"
+    "timestamp": "2023-02-21T19:45:48Z",
+    "host": "%[1]s"
   },
   {
     "object": "o2",
     "value": "value for o2",
     "try": 1,
     "statusCode": 200,
-    "timestamp": "2023-02-21T19:45:48Z"
+    "timestamp": "2023-02-21T19:45:48Z",
+    "host": "%[1]s"
   }
 ]
+`, client.params.Host),
+		buf.String(),
+	)
+}
+
+func TestClient_Run_Properties(t *testing.T) {
+	client := newTestClient(
+		t,
+		func(w http.ResponseWriter, r *http.Request) {
+			object := r.URL.Query().Get("Object")
+			_, _ = fmt.Fprintf(w, "{\"Content\": \"value for %s\", \"UserName\": \"user of %s\"}\n", object, object)
+		},
+	)
+	client.params.Properties = []string{"UserName"}
+	buf := captureOutput(client)
+
+	require.NoError(t, client.Run(context.Background()))
+	assert.Equal(
+		t,
+		"o1='value for o1'\no1_UserName='user of o1'\no2='value for o2'\no2_UserName='user of o2'\n",
+		buf.String(),
+	)
+
+	cache, err := NewDBCache()
+	require.NoError(t, err)
+
+	defer cache.Close()
+
+	require.NoError(t, cache.Unlock("test", NewKeySource(client.params.Config)))
+
+	acct, err := cache.get("test", "o1")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"UserName": "user of o1"}, acct.Properties)
+}
+
+func TestClient_Run_Stdin(t *testing.T) {
+	client := newTestClient(
+		t,
+		func(w http.ResponseWriter, r *http.Request) {
+			object := r.URL.Query().Get("Object")
+
+			if object == "o3" {
+				w.WriteHeader(http.StatusNotFound)
+			} else {
+				_, _ = fmt.Fprintf(w, "{\"Content\": \"value for %s\", \"UserName\": \"user of %s\"}\n", object, object)
+			}
+		},
+	)
+	client.params.Objects = nil
+	client.params.MaxConns = 2
+	client.stdin = strings.NewReader(`# ${CYBERARK:commented}
+url: jdbc://${CYBERARK:o1#UserName}:${CYBERARK:o1}@${CYBERARK:o3#Address|default=localhost}/db
+PASSWORD=${CYBERARK:o2}
+  spaces	and tabs are kept
+last line without end of line`)
+	buf := captureOutput(client)
+
+	require.NoError(t, client.Run(context.Background()))
+	assert.Equal(
+		t,
+		`# ${CYBERARK:commented}
+url: jdbc://user of o1:value for o1@localhost/db
+PASSWORD=value for o2
+  spaces	and tabs are kept
+last line without end of line`,
+		buf.String(),
+	)
+}
+
+func TestClient_Run_MissingProperty(t *testing.T) {
+	client := newTestClient(
+		t,
+		func(w http.ResponseWriter, r *http.Request) {
+			_, _ = fmt.Fprintf(w, "{\"Content\": \"value for %s\"}\n", r.URL.Query().Get("Object"))
+		},
+	)
+	client.params.Objects = nil
+	client.params.MaxConns = 2
+	client.stdin = strings.NewReader("HOST=${CYBERARK:o1#Adress}\nPASSWORD=${CYBERARK:o1}\n")
+	buf := captureOutput(client)
+
+	require.Error(t, client.Run(context.Background()))
+	assert.Equal(t, "HOST=${CYBERARK:o1#Adress}\nPASSWORD=value for o1\n", buf.String())
+}
+
+func TestClient_Run_Slash(t *testing.T) {
+	client := newTestClient(
+		t,
+		func(w http.ResponseWriter, r *http.Request) {
+			_, _ = fmt.Fprintf(w, "{\"Content\": \"value for %s\"}\n", r.URL.Query().Get("Object"))
+		},
+	)
+	client.params.Objects = []string{"a/b"}
+	buf := captureOutput(client)
+
+	require.NoError(t, client.Run(context.Background()))
+	assert.Equal(t, "a_b='value for a/b'\n", buf.String(), "not another config")
+}
+
+func TestClient_Run_OtherConfig(t *testing.T) {
+	client := newTestClient(
+		t,
+		func(w http.ResponseWriter, r *http.Request) {
+			query := r.URL.Query()
+			_, _ = fmt.Fprintf(w, "{\"Content\": \"value for %s in %s\"}\n", query.Get("Object"), query.Get("Safe"))
+		},
+	)
+	other := newTestServer(
+		t,
+		func(w http.ResponseWriter, r *http.Request) {
+			query := r.URL.Query()
+			_, _ = fmt.Fprintf(w, "{\"Content\": \"other value for %s in %s\"}\n", query.Get("Object"), query.Get("Safe"))
+		},
+	)
+	otherParams := newTestParameters(t, other)
+	otherParams.Safe = "otherSafe"
+	otherParams.CacheKeyFile = newTestKeyFile(t)
+	client.endpoints["other"] = newHTTPEndpoint("other", otherParams.Config, other.Client())
+	client.params.Objects = nil
+	client.params.MaxConns = 2
+	client.stdin = strings.NewReader(
+		"KEY1=${CYBERARK:o1}\nKEY2=${CYBERARK:other/o1}\nKEY3=${CYBERARK:unknown/o1}\n",
+	)
+	buf := captureOutput(client)
+
+	require.Error(t, client.Run(context.Background()))
+	assert.Equal(
+		t,
+		"KEY1=value for o1 in safe\nKEY2=other value for o1 in otherSafe\nKEY3=${CYBERARK:unknown/o1}\n",
+		buf.String(),
+	)
+
+	cache, err := NewDBCache()
+	require.NoError(t, err)
+
+	defer cache.Close()
+
+	require.NoError(t, cache.Unlock("other", NewKeySource(otherParams.Config)))
+
+	acct, err := cache.get("other", "o1")
+	require.NoError(t, err)
+	assert.Equal(t, "other value for o1 in otherSafe", acct.Value)
+}
+
+func TestClient_Run_MemoryCache(t *testing.T) {
+	calls := 0
+	client := newTestClient(
+		t,
+		func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			_, _ = fmt.Fprintf(w, "{\"Content\": \"value for %s\"}\n", r.URL.Query().Get("Object"))
+		},
+	)
+	ep := client.endpoints["test"]
+	ep.config.CacheBackend = cacheBackendMemory
+	client.endpoints["test"] = ep
+	client.params.Objects = []string{"memory-o1"}
+
+	require.NoError(t, client.Run(context.Background()))
+	require.NoError(t, client.Run(context.Background()))
+	assert.Equal(t, 1, calls)
+
+	cache, err := NewDBCache()
+	require.NoError(t, err)
+
+	defer cache.Close()
+
+	configs, err := cache.Configs("")
+	require.NoError(t, err)
+	assert.Empty(t, configs)
+}
+
+// newVersionedClient returns a test client whose server answers a new value on each call, or 503 when down.
+// It also returns the count of answered calls and the count of every request, failed ones included.
+func newVersionedClient(t *testing.T) (Client, *atomic.Int32, *atomic.Bool, *atomic.Int32) {
+	t.Helper()
+
+	calls := &atomic.Int32{}
+	down := &atomic.Bool{}
+	requests := &atomic.Int32{}
+	client := newTestClient(
+		t,
+		func(w http.ResponseWriter, r *http.Request) {
+			requests.Add(1)
+
+			if down.Load() {
+				w.WriteHeader(http.StatusServiceUnavailable)
+
+				return
+			}
+
+			_, _ = fmt.Fprintf(w, "{\"Content\": \"value %d for %s\"}\n", calls.Add(1), r.URL.Query().Get("Object"))
+		},
+	)
+	client.params.Objects = []string{"o1"}
+	client.params.Expiry = time.Hour
+	client.params.MaxStale = time.Hour
+	client.endpoints["test"] = newHTTPEndpoint("test", client.params.Config, client.endpoints["test"].http)
+
+	return client, calls, down, requests
+}
+
+func TestClient_Run_Hits(t *testing.T) {
+	client := newTestClient(
+		t,
+		func(w http.ResponseWriter, r *http.Request) {
+			_, _ = fmt.Fprintf(w, "{\"Content\": \"value for %s\"}\n", r.URL.Query().Get("Object"))
+		},
+	)
+	client.params.Objects = []string{"o1"}
+
+	ep := client.endpoints["test"]
+	ep.config.MaxStale = time.Hour
+	client.endpoints["test"] = ep
+
+	hits := func() int {
+		t.Helper()
+
+		cache, err := NewDBCache()
+		require.NoError(t, err)
+
+		defer cache.Close()
+
+		accounts, err := cache.SortedAccounts("test", "", nil)
+		require.NoError(t, err)
+		require.Len(t, accounts, 1)
+
+		return accounts[0].Hits
+	}
+
+	require.NoError(t, client.Run(context.Background()))
+	assert.Equal(t, 0, hits(), "fetched")
+
+	require.NoError(t, client.Run(context.Background()))
+	assert.Equal(t, 1, hits(), "cached")
+
+	client.clock = fixedClock{t: now.Add(defaultExpiry + time.Minute)}
+
+	require.NoError(t, client.Run(context.Background()))
+	assert.Equal(t, 1, hits(), "fetched again after expiry")
+}
+
+func TestClient_Run_Expiry(t *testing.T) {
+	client, calls, down, requests := newVersionedClient(t)
+
+	require.NoError(t, client.Run(context.Background()))
+
+	buf := captureOutput(client)
+
+	require.NoError(t, client.Run(context.Background()))
+	assert.Equal(t, "o1='value 1 for o1'\n", buf.String(), "fresh")
+
+	client.clock = fixedClock{t: now.Add(90 * time.Minute)}
+	buf = captureOutput(client)
+
+	require.NoError(t, client.Run(context.Background()))
+	assert.Equal(t, "o1='value 2 for o1'\n", buf.String(), "expired")
+
+	down.Store(true)
+	requests.Store(0)
+
+	client.clock = fixedClock{t: now.Add(3 * time.Hour)}
+	buf = captureOutput(client)
+
+	require.NoError(t, client.Run(context.Background()))
+	assert.Equal(t, "o1='value 2 for o1'\n", buf.String(), "stale less than max-stale")
+	assert.Equal(t, int32(client.params.MaxTries), requests.Load(), "stale value not revalidated after failed tries")
+
+	client.clock = fixedClock{t: now.Add(4 * time.Hour)}
+
+	require.Error(t, client.Run(context.Background()), "stale more than max-stale")
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestClient_Run_StaleWhileRevalidate(t *testing.T) {
+	client, calls, down, requests := newVersionedClient(t)
+
+	ep := client.endpoints["test"]
+	ep.config.StaleWhileRevalidate = true
+	client.endpoints["test"] = ep
+	client.params.Format = formatJSON
+
+	require.NoError(t, client.Run(context.Background()))
+
+	client.clock = fixedClock{t: now.Add(90 * time.Minute)}
+	down.Store(true)
+
+	accounts, err := client.fetch(context.Background(), client.readFromParams())
+	require.NoError(t, err)
+	require.Len(t, accounts, 1)
+	assert.Equal(t, "value 1 for o1", accounts[0].Value)
+	assert.True(t, accounts[0].Stale)
+
+	client.wait()
+	assert.Equal(t, int32(1), calls.Load(), "failed revalidation")
+	assert.Equal(t, int32(1+client.params.MaxTries), requests.Load(), "revalidated once")
+
+	down.Store(false)
+
+	accounts, err = client.fetch(context.Background(), client.readFromParams())
+	require.NoError(t, err)
+	assert.Equal(t, "value 1 for o1", accounts[0].Value)
+
+	client.wait()
+	assert.Equal(t, int32(2), calls.Load(), "revalidated")
+
+	accounts, err = client.fetch(context.Background(), client.readFromParams())
+	require.NoError(t, err)
+	assert.Equal(t, "value 2 for o1", accounts[0].Value)
+	assert.False(t, accounts[0].Stale)
+}
+
+func TestClient_Run_Offline(t *testing.T) {
+	client, calls, _, _ := newVersionedClient(t)
+
+	require.NoError(t, client.Run(context.Background()))
+
+	client.clock = fixedClock{t: now.Add(4 * time.Hour)}
+	client.params.Offline = true
+	buf := captureOutput(client)
+
+	require.NoError(t, client.Run(context.Background()))
+	assert.Equal(t, "o1='value 1 for o1'\n", buf.String(), "expired")
+
+	client.params.Objects = []string{"o2"}
+
+	require.Error(t, client.Run(context.Background()), "not cached")
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestClient_Run_FallbackToCache(t *testing.T) {
+	client, calls, down, requests := newVersionedClient(t)
+
+	require.NoError(t, client.Run(context.Background()))
+
+	down.Store(true)
+	requests.Store(0)
+
+	client.clock = fixedClock{t: now.Add(4 * time.Hour)}
+	client.params.FallbackToCache = true
+	buf := captureOutput(client)
+	errBuf := &bytes.Buffer{}
+	client.params = client.params.WithLog(log.New(errBuf, "", 0))
+
+	require.NoError(t, client.Run(context.Background()))
+	assert.Equal(t, "o1='value 1 for o1'\n", buf.String())
+	assert.Equal(t, int32(1), calls.Load())
+	assert.Equal(t, int32(client.params.MaxTries), requests.Load(), "max tries, without revalidation")
+	assert.Equal(t, client.params.MaxTries, strings.Count(errBuf.String(), "Failed to get o1"), "reported once")
+}
+
+func TestClient_Run_NoCache(t *testing.T) {
+	client, calls, _, _ := newVersionedClient(t)
+	client.params.NoCache = true
+
+	require.NoError(t, client.Run(context.Background()))
+	require.NoError(t, client.Run(context.Background()))
+	assert.Equal(t, int32(2), calls.Load())
+
+	cache, err := NewDBCache()
+	require.NoError(t, err)
+
+	defer cache.Close()
+
+	configs, err := cache.Configs("")
+	require.NoError(t, err)
+	assert.Empty(t, configs)
+}
+
+func TestClient_Run_Refresh(t *testing.T) {
+	client, calls, _, _ := newVersionedClient(t)
+
+	require.NoError(t, client.Run(context.Background()))
+
+	client.clock = fixedClock{t: now.Add(time.Minute)}
+	client.params.Refresh = true
+
+	require.NoError(t, client.Run(context.Background()))
+
+	client.params.Refresh = false
+	buf := captureOutput(client)
+
+	require.NoError(t, client.Run(context.Background()))
+	assert.Equal(t, "o1='value 2 for o1'\n", buf.String())
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestClient_Run_Latency(t *testing.T) {
+	offset := &atomic.Int64{}
+	client := newTestClient(
+		t,
+		func(w http.ResponseWriter, r *http.Request) {
+			offset.Add(int64(250 * time.Millisecond))
+
+			_, _ = fmt.Fprintf(w, "{\"Content\": \"value for %s\"}\n", r.URL.Query().Get("Object"))
+		},
+	)
+	client.clock = advancingClock{fixedClock: newFixedClock(), offset: offset}
+	client.params.Objects = []string{"o1"}
+
+	accounts, err := client.fetch(context.Background(), client.readFromParams())
+	require.NoError(t, err)
+	require.Len(t, accounts, 1)
+	assert.Equal(t, 250*time.Millisecond, accounts[0].latency)
+}
+
+func TestClient_Run_Stats(t *testing.T) {
+	client, _, _, _ := newVersionedClient(t)
+
+	require.NoError(t, client.Run(context.Background()))
+
+	client.params.Objects = []string{"o1", "o2"}
+	client.params.Format = formatJSON
+	client.params.Stats = true
+	buf := captureOutput(client)
+
+	require.NoError(t, client.Run(context.Background()))
+
+	var output struct {
+		Accounts []Account `json:"accounts"`
+		Stats    struct {
+			Hits     int `json:"hits"`
+			Misses   int `json:"misses"`
+			Accounts []struct {
+				Object string `json:"object"`
+				Cached bool   `json:"cached"`
+			} `json:"accounts"`
+		} `json:"stats"`
+	}
+
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &output))
+	assert.Len(t, output.Accounts, 2)
+	assert.Equal(t, 1, output.Stats.Hits, "o1 cached")
+	assert.Equal(t, 2, output.Stats.Misses, "o1 then o2 fetched")
+	require.Len(t, output.Stats.Accounts, 3)
+	assert.True(t, output.Stats.Accounts[1].Cached)
+	assert.False(t, output.Stats.Accounts[2].Cached)
+}
+
+func TestClient_Run_SingleFlight(t *testing.T) {
+	calls := &atomic.Int32{}
+	client := newTestClient(
+		t,
+		func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			time.Sleep(100 * time.Millisecond)
+
+			_, _ = fmt.Fprintf(w, "{\"Content\": \"value for %s\"}\n", r.URL.Query().Get("Object"))
+		},
+	)
+	client.params.Objects = []string{"o1"}
+
+	// each run opens its own cache, as another process would
+	var wg sync.WaitGroup
+
+	for range 4 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			assert.NoError(t, client.Run(context.Background()))
+		}()
+	}
+
+	wg.Wait()
+
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestClient_Refresh(t *testing.T) {
+	client, calls, down, _ := newVersionedClient(t)
+	client.params.Objects = []string{"o1", "o2"}
+
+	require.NoError(t, client.Run(context.Background()))
+
+	client.clock = fixedClock{t: now.Add(time.Minute)}
+	buf := captureOutput(client)
+
+	require.NoError(t, client.Refresh(context.Background()))
+	assert.Contains(t, buf.String(), "o1: changed\n")
+	assert.Contains(t, buf.String(), "o2: changed\n")
+	assert.Contains(t, buf.String(), "2 account(s) refreshed, 2 changed\n")
+	assert.Equal(t, int32(4), calls.Load())
+
+	down.Store(true)
+
+	buf = captureOutput(client)
+
+	require.Error(t, client.Refresh(context.Background()))
+	assert.Contains(t, buf.String(), "o1: failed")
+	assert.Contains(t, buf.String(), "2 account(s) refreshed, 0 changed\n")
+
+	down.Store(false)
+	client.params.Objects = []string{"o1"}
+	buf = captureOutput(client)
+
+	require.NoError(t, client.Run(context.Background()))
+	assert.Regexp(t, "^o1='value [34] for o1'\n$", buf.String(), "updated in place")
+}
+
+func TestClient_Refresh_sameSecond(t *testing.T) {
+	client, _, _, _ := newVersionedClient(t)
+
+	require.NoError(t, client.Run(context.Background()))
+
+	captureOutput(client)
+	require.NoError(t, client.Refresh(context.Background()))
+
+	buf := captureOutput(client)
+
+	require.NoError(t, client.Run(context.Background()))
+	assert.Equal(t, "o1='value 2 for o1'\n", buf.String())
+}
+
+func TestClient_Run_K8sSecret(t *testing.T) {
+	client := newTestClient(
+		t,
+		func(w http.ResponseWriter, r *http.Request) {
+			object := r.URL.Query().Get("Object")
+			_, _ = fmt.Fprintf(w, "{\"Content\": \"value for %s\"}\n", object)
+		},
+	)
+	client.params.Format = formatK8sSecret
+	client.params.SecretName = "my-secret"
+	buf := captureOutput(client)
+
+	require.NoError(t, client.Run(context.Background()))
+	assert.Equal(
+		t,
+		`apiVersion: v1
+kind: Secret
+metadata:
+  name: "my-secret"
+type: Opaque
+data:
+  "o1": dmFsdWUgZm9yIG8x
+  "o2": dmFsdWUgZm9yIG8y
 `,
 		buf.String(),
 	)
@@ -141,7 +757,7 @@ func TestClient_Run_BadRequest(t *testing.T) {
 	)
 	buf := captureOutput(client)
 
-	require.Error(t, client.Run())
+	require.Error(t, client.Run(context.Background()))
 	assert.Equal(t, "o1='value for o1'\n", buf.String())
 }
 
@@ -160,7 +776,7 @@ func TestClient_Run_InvalidJson(t *testing.T) {
 	)
 	buf := captureOutput(client)
 
-	require.Error(t, client.Run())
+	require.Error(t, client.Run(context.Background()))
 	assert.Equal(t, "o1='value for o1'\n", buf.String())
 }
 
@@ -186,12 +802,272 @@ func TestClient_Run_Retry(t *testing.T) {
 	)
 	buf := captureOutput(client)
 
-	require.NoError(t, client.Run())
+	require.NoError(t, client.Run(context.Background()))
 	assert.Equal(t, "o1='value for o1'\no2='value for o2'\n", buf.String())
 	assert.Contains(t, objects, "o1")
 	assert.Contains(t, objects, "o2")
 }
 
+func TestClient_Run_RetryPolicy(t *testing.T) {
+	var tries atomic.Int32
+
+	client := newTestClient(
+		t,
+		func(w http.ResponseWriter, _ *http.Request) {
+			switch tries.Add(1) {
+			case 1:
+				w.Header().Set("Retry-After", "7")
+				w.WriteHeader(http.StatusTooManyRequests)
+			case 2:
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = fmt.Fprintln(w, `{"ErrorCode": "APPAP004E", "ErrorMsg": "Password object matching query not found"}`)
+			default:
+				_, _ = fmt.Fprintln(w, `{"Content": "value"}`)
+			}
+		},
+	)
+	client.params.Objects = []string{"o1"}
+
+	ep := client.endpoints["test"]
+	ep.config.MaxTries = 3
+	ep.config.RetryErrorCodes = []string{"APPAP004E"}
+	ep.config.RetryStatuses = []int{http.StatusTooManyRequests}
+	ep.config.Wait = time.Second
+	client.endpoints["test"] = ep
+
+	var delays []time.Duration
+
+	client.clock = recordingClock{fixedClock: newFixedClock(), delays: &delays, mutex: &sync.Mutex{}}
+	buf := captureOutput(client)
+
+	require.NoError(t, client.Run(context.Background()))
+	assert.Equal(t, "o1='value'\n", buf.String())
+	assert.Equal(t, []time.Duration{7 * time.Second, 2 * time.Second}, delays)
+}
+
+// newTestHostsClient returns a client of a configuration whose hosts are test servers,
+// by order of priority, the ones of the given handlers.
+func newTestHostsClient(t *testing.T, priorities []int, handlers ...http.HandlerFunc) (Client, []string) {
+	t.Helper()
+
+	client := newTestClient(t, handlers[0])
+	hosts := []string{client.params.Host}
+	client.params.Hosts = map[string]int{client.params.Host: priorities[0]}
+
+	for i, handler := range handlers[1:] {
+		params := newTestParameters(t, newTestServer(t, handler))
+		hosts = append(hosts, params.Host)
+		client.params.Hosts[params.Host] = priorities[i+1]
+	}
+
+	// test servers share the same certificate
+	client.endpoints["test"] = newHTTPEndpoint("test", client.params.Config, client.endpoints["test"].http)
+
+	return client, hosts
+}
+
+func TestClient_Run_Failover(t *testing.T) {
+	var primaryCalls, secondaryCalls atomic.Int32
+
+	client, hosts := newTestHostsClient(
+		t,
+		[]int{1, 2},
+		func(w http.ResponseWriter, _ *http.Request) {
+			primaryCalls.Add(1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		},
+		func(w http.ResponseWriter, r *http.Request) {
+			secondaryCalls.Add(1)
+			_, _ = fmt.Fprintf(w, "{\"Content\": \"value for %s\"}\n", r.URL.Query().Get("Object"))
+		},
+	)
+	client.params.Objects = []string{"o1"}
+	client.params.NoCache = true
+	buf := captureOutput(client)
+
+	accounts, err := client.fetch(context.Background(), client.readFromParams())
+	require.NoError(t, err)
+	require.Len(t, accounts, 1)
+	assert.True(t, accounts[0].ok())
+	assert.Equal(t, "value for o1", accounts[0].Value)
+	assert.Equal(t, hosts[1], accounts[0].Host)
+	assert.Equal(t, 1, accounts[0].Try, "failover within a try")
+	assert.Equal(t, int32(1), primaryCalls.Load())
+	assert.Equal(t, int32(1), secondaryCalls.Load())
+
+	require.NoError(t, client.Run(context.Background()))
+	assert.Contains(t, buf.String(), "value for o1")
+	assert.Equal(t, int32(1), primaryCalls.Load(), "unhealthy primary left aside")
+	assert.Equal(t, int32(2), secondaryCalls.Load())
+
+	client.clock = fixedClock{t: now.Add(defaultHostCooldown)}
+
+	require.NoError(t, client.Run(context.Background()))
+	assert.Equal(t, int32(2), primaryCalls.Load(), "primary tried again after cool-down")
+	assert.Equal(t, int32(3), secondaryCalls.Load())
+}
+
+func TestClient_Run_RoundRobin(t *testing.T) {
+	var calls [2]atomic.Int32
+
+	handler := func(i int) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			calls[i].Add(1)
+			_, _ = fmt.Fprintf(w, "{\"Content\": \"value for %s\"}\n", r.URL.Query().Get("Object"))
+		}
+	}
+
+	client, _ := newTestHostsClient(t, []int{1, 1}, handler(0), handler(1))
+	client.params.Objects = []string{"o1", "o2", "o3", "o4"}
+	client.params.NoCache = true
+
+	require.NoError(t, client.Run(context.Background()))
+	assert.Equal(t, int32(2), calls[0].Load())
+	assert.Equal(t, int32(2), calls[1].Load())
+}
+
+func TestClient_Run_AllHostsDown(t *testing.T) {
+	var calls atomic.Int32
+
+	handler := func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}
+
+	client, hosts := newTestHostsClient(t, []int{1, 2}, handler, handler)
+	client.params.Objects = []string{"o1"}
+	client.params.NoCache = true
+
+	accounts, err := client.fetch(context.Background(), client.readFromParams())
+	require.NoError(t, err)
+	require.Len(t, accounts, 1)
+	assert.Equal(t, http.StatusBadGateway, accounts[0].StatusCode)
+	assert.Equal(t, 2, accounts[0].Try)
+	assert.Contains(t, hosts, accounts[0].Host)
+	assert.Equal(t, int32(4), calls.Load(), "every host on each try")
+}
+
+func TestClient_Run_Rate(t *testing.T) {
+	client := newTestClient(
+		t,
+		func(w http.ResponseWriter, r *http.Request) {
+			_, _ = fmt.Fprintf(w, "{\"Content\": \"value for %s\"}\n", r.URL.Query().Get("Object"))
+		},
+	)
+	client.params.Objects = []string{"o1", "o2", "o3", "o4", "o5"}
+	client.params.Rate = 2
+	client.endpoints["test"] = newHTTPEndpoint("test", client.params.Config, client.endpoints["test"].http)
+
+	var delays []time.Duration
+
+	client.clock = recordingClock{fixedClock: newFixedClock(), delays: &delays, mutex: &sync.Mutex{}}
+
+	require.NoError(t, client.Run(context.Background()))
+	assert.ElementsMatch(t, []time.Duration{500 * time.Millisecond, time.Second, 1500 * time.Millisecond}, delays)
+}
+
+func TestClient_Run_RateBeforeLock(t *testing.T) {
+	client := newTestClient(
+		t,
+		func(w http.ResponseWriter, r *http.Request) {
+			_, _ = fmt.Fprintf(w, "{\"Content\": \"value for %s\"}\n", r.URL.Query().Get("Object"))
+		},
+	)
+	client.params.Objects = []string{"o1", "o2"}
+	client.params.MaxConns = 1
+	client.params.Rate = 1
+	client.endpoints["test"] = newHTTPEndpoint("test", client.params.Config, client.endpoints["test"].http)
+
+	waits := 0
+
+	client.clock = callbackClock{fixedClock: newFixedClock(), callback: func(time.Duration) {
+		waits++
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		lock, err := lockAccount(ctx, "test", "o2")
+		if assert.NoError(t, err, "not locked while waiting for the rate limit") {
+			lock.unlock()
+		}
+	}}
+
+	require.NoError(t, client.Run(context.Background()))
+	assert.Equal(t, 1, waits)
+}
+
+func TestClient_Run_Breaker(t *testing.T) {
+	var calls atomic.Int32
+
+	client := newTestClient(
+		t,
+		func(w http.ResponseWriter, _ *http.Request) {
+			calls.Add(1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		},
+	)
+	client.params.Objects = []string{"o1", "o2", "o3", "o4"}
+	client.params.MaxConns = 1
+	client.params.MaxTries = 3
+	client.params.BreakerThreshold = 2
+	client.endpoints["test"] = newHTTPEndpoint("test", client.params.Config, client.endpoints["test"].http)
+
+	accounts, err := client.fetch(context.Background(), client.readFromParams())
+	require.NoError(t, err)
+	require.Len(t, accounts, 4)
+	assert.Equal(t, int32(2), calls.Load(), "remaining accounts failed fast")
+
+	open := 0
+
+	for _, acct := range accounts {
+		require.False(t, acct.ok())
+
+		if strings.Contains(acct.Error.Error(), `circuit breaker of config "test" open after 2 consecutive failures`) {
+			open++
+		}
+	}
+
+	assert.Equal(t, 4, open, "retries failed fast too")
+}
+
+func TestClient_Run_Deadline(t *testing.T) {
+	client := newTestClient(
+		t,
+		func(_ http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+		},
+	)
+	client.params.Deadline = 100 * time.Millisecond
+	start := time.Now()
+
+	require.Error(t, client.Run(context.Background()))
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestClient_Run_CanceledWhileRetrying(t *testing.T) {
+	client := newTestClient(
+		t,
+		func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		},
+	)
+	client.clock = stuckClock{newFixedClock()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	accounts, err := client.fetch(ctx, client.readFromParams())
+
+	require.NoError(t, err)
+	assert.Less(t, time.Since(start), 5*time.Second)
+	require.Len(t, accounts, 2)
+
+	for _, acct := range accounts {
+		require.ErrorIs(t, acct.Error, context.DeadlineExceeded)
+	}
+}
+
 func TestClient_poolSize(t *testing.T) {
 	tests := []struct {
 		name   string
@@ -245,85 +1121,22 @@ func TestClient_poolSize(t *testing.T) {
 	}
 }
 
-func TestClient_query(t *testing.T) {
-	client := &Client{
-		params: Parameters{
-			Config: Config{
-				AppID: "appId",
-				Safe:  "safe",
-			},
-		},
-	}
-
-	assert.Equal(
-		t,
-		url.Values{
-			"AppID":  []string{"appId"},
-			"Safe":   []string{"safe"},
-			"Object": []string{"o1"},
-		},
-		client.query("o1"),
-	)
-}
-
-func TestClient_url(t *testing.T) {
-	client := &Client{
-		params: Parameters{
-			Config: Config{Host: "host"},
-		},
-	}
-
-	assert.Equal(
-		t,
-		&url.URL{
-			Scheme:   "https",
-			Host:     "host",
-			Path:     "/AIMWebService/api/Accounts",
-			RawQuery: "AppID=appId&Safe=safe",
-		},
-		client.url(
-			url.Values{
-				"AppID": []string{"appId"},
-				"Safe":  []string{"safe"},
-			},
-		),
-	)
-}
-
-func TestClient_lineRegex(t *testing.T) {
-	assert.Nil(t, lineRegex.FindStringSubmatch("KEY=VALUE"))
-	assert.Equal(
-		t,
-		[]string{"KEY=${CYBERARK:OBJECT}", "KEY", "", "OBJECT", ""},
-		lineRegex.FindStringSubmatch("KEY=${CYBERARK:OBJECT}"),
-	)
-	assert.Equal(
-		t,
-		[]string{"KEY=PREFIX_${CYBERARK:OBJECT}_SUFFIX", "KEY", "PREFIX_", "OBJECT", "_SUFFIX"},
-		lineRegex.FindStringSubmatch("KEY=PREFIX_${CYBERARK:OBJECT}_SUFFIX"),
-	)
-}
-
 func TestClient_readFromReader(t *testing.T) {
 	client := Client{
 		clock: newFixedClock(),
-		log:   log.New(io.Discard, "", 0),
 	}
-	buf := captureOutput(client)
-	in := make(chan *Account, 1)
 
-	assert.Equal(
-		t,
-		1,
-		client.readFromReader(in, strings.NewReader("KEY1=${CYBERARK:o1}\nKEY2=VALUE2")),
-	)
+	accounts, tmpl, err := client.readFromReader(strings.NewReader(
+		"USER=${CYBERARK:o1#UserName}\nPASSWORD=${CYBERARK:o1}\nHOST=${CYBERARK:o2#Address|default=localhost}",
+	))
 
-	assert.Equal(t, "KEY2=VALUE2\n", buf.String())
+	require.NoError(t, err)
+	assert.Len(t, tmpl.lines, 3)
+	require.Len(t, accounts, 2)
 
-	result := <-in
+	assert.Equal(t, "o1", accounts[0].Object)
+	assert.Equal(t, []placeholder{{property: "UserName"}, {}}, accounts[0].placeholders)
 
-	assert.Equal(t, "o1", result.Object)
-	assert.Equal(t, "KEY1", result.key)
-	assert.Equal(t, "", result.prefix)
-	assert.Equal(t, "", result.suffix)
+	assert.Equal(t, "o2", accounts[1].Object)
+	assert.Equal(t, []placeholder{{property: "Address", fallback: ptr("localhost")}}, accounts[1].placeholders)
 }
@@ -4,6 +4,7 @@ import "time"
 
 type clock interface {
 	now() time.Time
+	after(d time.Duration) <-chan time.Time
 }
 
 type utcClock struct{}
@@ -12,6 +13,10 @@ func (c utcClock) now() time.Time {
 	return time.Now().UTC()
 }
 
+func (c utcClock) after(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
 type fixedClock struct {
 	t time.Time
 }
@@ -19,3 +24,12 @@ type fixedClock struct {
 func (c fixedClock) now() time.Time {
 	return c.t
 }
+
+// after does not wait, the time of a fixed clock never passing.
+func (c fixedClock) after(time.Duration) <-chan time.Time {
+	result := make(chan time.Time, 1)
+
+	result <- c.t
+
+	return result
+}
@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"cmp"
 	"fmt"
 	"strings"
 	"time"
@@ -15,18 +16,33 @@ const (
 )
 
 type Config struct {
-	Aliases    []string      `json:"aliases"`
-	AppID      string        `json:"app-id"`    //nolint:tagliatelle
-	CertFile   string        `json:"cert-file"` //nolint:tagliatelle
-	Expiry     time.Duration `json:"expiry"`
-	Host       string        `json:"host"`
-	KeyFile    string        `json:"key-file"`        //nolint:tagliatelle
-	MaxConns   int           `json:"max-connections"` //nolint:tagliatelle
-	MaxTries   int           `json:"max-tries"`       //nolint:tagliatelle
-	Safe       string        `json:"safe"`
-	SkipVerify bool          `json:"skip-verify"` //nolint:tagliatelle
-	Timeout    time.Duration `json:"timeout"`
-	Wait       time.Duration `json:"wait"`
+	Criteria
+
+	Aliases              []string       `json:"aliases"`
+	AppID                string         `json:"app-id"`                      //nolint:tagliatelle
+	BreakerCooldown      time.Duration  `json:"breaker-cooldown,omitempty"`  //nolint:tagliatelle
+	BreakerThreshold     int            `json:"breaker-threshold,omitempty"` //nolint:tagliatelle
+	CacheBackend         string         `json:"cache-backend,omitempty"`     //nolint:tagliatelle
+	CacheKeyFile         string         `json:"cache-key-file,omitempty"`    //nolint:tagliatelle
+	CertFile             string         `json:"cert-file"`                   //nolint:tagliatelle
+	Expiry               time.Duration  `json:"expiry"`
+	Host                 string         `json:"host"`
+	HostCooldown         time.Duration  `json:"host-cooldown,omitempty"` //nolint:tagliatelle
+	Hosts                map[string]int `json:"hosts,omitempty"`
+	Jitter               float64        `json:"jitter,omitempty"`
+	KeyFile              string         `json:"key-file"`            //nolint:tagliatelle
+	MaxConns             int            `json:"max-connections"`     //nolint:tagliatelle
+	MaxStale             time.Duration  `json:"max-stale,omitempty"` //nolint:tagliatelle
+	MaxTries             int            `json:"max-tries"`           //nolint:tagliatelle
+	MaxWait              time.Duration  `json:"max-wait,omitempty"`  //nolint:tagliatelle
+	Rate                 float64        `json:"rate,omitempty"`
+	RetryErrorCodes      []string       `json:"retry-error-codes,omitempty"` //nolint:tagliatelle
+	RetryStatuses        []int          `json:"retry-statuses,omitempty"`    //nolint:tagliatelle
+	Safe                 string         `json:"safe"`
+	SkipVerify           bool           `json:"skip-verify"`                      //nolint:tagliatelle
+	StaleWhileRevalidate bool           `json:"stale-while-revalidate,omitempty"` //nolint:tagliatelle
+	Timeout              time.Duration  `json:"timeout"`
+	Wait                 time.Duration  `json:"wait"`
 }
 
 func NewConfig() Config {
@@ -50,6 +66,22 @@ func (c Config) Overwrite(other Config) Config { //nolint:cyclop
 		c.AppID = other.AppID
 	}
 
+	if other.BreakerCooldown != 0 {
+		c.BreakerCooldown = other.BreakerCooldown
+	}
+
+	if other.BreakerThreshold != 0 {
+		c.BreakerThreshold = other.BreakerThreshold
+	}
+
+	if other.CacheBackend != "" {
+		c.CacheBackend = other.CacheBackend
+	}
+
+	if other.CacheKeyFile != "" {
+		c.CacheKeyFile = other.CacheKeyFile
+	}
+
 	if other.CertFile != "" {
 		c.CertFile = other.CertFile
 	}
@@ -62,6 +94,18 @@ func (c Config) Overwrite(other Config) Config { //nolint:cyclop
 		c.Host = other.Host
 	}
 
+	if other.HostCooldown != 0 {
+		c.HostCooldown = other.HostCooldown
+	}
+
+	if len(other.Hosts) > 0 {
+		c.Hosts = other.Hosts
+	}
+
+	if other.Jitter != 0 {
+		c.Jitter = other.Jitter
+	}
+
 	if other.KeyFile != "" {
 		c.KeyFile = other.KeyFile
 	}
@@ -70,10 +114,30 @@ func (c Config) Overwrite(other Config) Config { //nolint:cyclop
 		c.MaxConns = other.MaxConns
 	}
 
+	if other.MaxStale != 0 {
+		c.MaxStale = other.MaxStale
+	}
+
 	if other.MaxTries != defaultMaxTries {
 		c.MaxTries = other.MaxTries
 	}
 
+	if other.MaxWait != 0 {
+		c.MaxWait = other.MaxWait
+	}
+
+	if other.Rate != 0 {
+		c.Rate = other.Rate
+	}
+
+	if len(other.RetryErrorCodes) > 0 {
+		c.RetryErrorCodes = other.RetryErrorCodes
+	}
+
+	if len(other.RetryStatuses) > 0 {
+		c.RetryStatuses = other.RetryStatuses
+	}
+
 	if other.Safe != "" {
 		c.Safe = other.Safe
 	}
@@ -88,24 +152,67 @@ func (c Config) Overwrite(other Config) Config { //nolint:cyclop
 		c.Wait = other.Wait
 	}
 
+	c.Criteria = c.Criteria.Overwrite(other.Criteria)
+
 	return c
 }
 
+// cacheBackend returns the cache backend of the configuration, SQLite by default.
+func (c Config) cacheBackend() string {
+	if c.CacheBackend == "" {
+		return cacheBackendSQLite
+	}
+
+	return c.CacheBackend
+}
+
+// sharedCache tells whether the cache backend is shared by processes.
+func (c Config) sharedCache() bool {
+	backend := c.cacheBackend()
+
+	return backend == cacheBackendSQLite || backend == cacheBackendKeyring
+}
+
 func (c Config) String() string {
 	sb := strings.Builder{}
 
-	sb.WriteString(fmt.Sprintf("  %-11s = %v\n", "aliases", strings.Join(c.Aliases, ", ")))
-	sb.WriteString(fmt.Sprintf("  %-11s = %v\n", "app-id", c.AppID))
-	sb.WriteString(fmt.Sprintf("  %-11s = %v\n", "cert-file", c.CertFile))
-	sb.WriteString(fmt.Sprintf("  %-11s = %v\n", "expiry", c.Expiry))
-	sb.WriteString(fmt.Sprintf("  %-11s = %v\n", "host", c.Host))
-	sb.WriteString(fmt.Sprintf("  %-11s = %v\n", "key-file", c.KeyFile))
-	sb.WriteString(fmt.Sprintf("  %-11s = %v\n", "max-conns", c.MaxConns))
-	sb.WriteString(fmt.Sprintf("  %-11s = %v\n", "max-tries", c.MaxTries))
-	sb.WriteString(fmt.Sprintf("  %-11s = %v\n", "safe", c.Safe))
-	sb.WriteString(fmt.Sprintf("  %-11s = %v\n", "skip-verify", c.SkipVerify))
-	sb.WriteString(fmt.Sprintf("  %-11s = %v\n", "timeout", c.Timeout))
-	sb.WriteString(fmt.Sprintf("  %-11s = %v\n", "wait", c.Wait))
+	retryStatuses := c.RetryStatuses
+	if len(retryStatuses) == 0 {
+		retryStatuses = defaultRetryStatuses()
+	}
+
+	sb.WriteString(fmt.Sprintf("  %-22s = %v\n", "address", c.Address))
+	sb.WriteString(fmt.Sprintf("  %-22s = %v\n", "aliases", strings.Join(c.Aliases, ", ")))
+	sb.WriteString(fmt.Sprintf("  %-22s = %v\n", "app-id", c.AppID))
+	sb.WriteString(fmt.Sprintf("  %-22s = %v\n", "breaker-cooldown", cmp.Or(c.BreakerCooldown, defaultBreakerCooldown)))
+	sb.WriteString(fmt.Sprintf("  %-22s = %v\n", "breaker-threshold", c.BreakerThreshold))
+	sb.WriteString(fmt.Sprintf("  %-22s = %v\n", "cache-backend", c.cacheBackend()))
+	sb.WriteString(fmt.Sprintf("  %-22s = %v\n", "cache-key-file", c.CacheKeyFile))
+	sb.WriteString(fmt.Sprintf("  %-22s = %v\n", "cert-file", c.CertFile))
+	sb.WriteString(fmt.Sprintf("  %-22s = %v\n", "database", c.Database))
+	sb.WriteString(fmt.Sprintf("  %-22s = %v\n", "expiry", c.Expiry))
+	sb.WriteString(fmt.Sprintf("  %-22s = %v\n", "folder", c.Folder))
+	sb.WriteString(fmt.Sprintf("  %-22s = %v\n", "host", c.Host))
+	sb.WriteString(fmt.Sprintf("  %-22s = %v\n", "host-cooldown", cmp.Or(c.HostCooldown, defaultHostCooldown)))
+	sb.WriteString(fmt.Sprintf("  %-22s = %v\n", "hosts", c.Hosts))
+	sb.WriteString(fmt.Sprintf("  %-22s = %v\n", "jitter", c.Jitter))
+	sb.WriteString(fmt.Sprintf("  %-22s = %v\n", "key-file", c.KeyFile))
+	sb.WriteString(fmt.Sprintf("  %-22s = %v\n", "max-conns", c.MaxConns))
+	sb.WriteString(fmt.Sprintf("  %-22s = %v\n", "max-stale", c.MaxStale))
+	sb.WriteString(fmt.Sprintf("  %-22s = %v\n", "max-tries", c.MaxTries))
+	sb.WriteString(fmt.Sprintf("  %-22s = %v\n", "max-wait", cmp.Or(c.MaxWait, defaultMaxWait)))
+	sb.WriteString(fmt.Sprintf("  %-22s = %v\n", "policy-id", c.PolicyID))
+	sb.WriteString(fmt.Sprintf("  %-22s = %v\n", "query", c.Query))
+	sb.WriteString(fmt.Sprintf("  %-22s = %v\n", "query-format", c.QueryFormat))
+	sb.WriteString(fmt.Sprintf("  %-22s = %v\n", "rate", c.Rate))
+	sb.WriteString(fmt.Sprintf("  %-22s = %v\n", "retry-error-codes", strings.Join(c.RetryErrorCodes, ", ")))
+	sb.WriteString(fmt.Sprintf("  %-22s = %v\n", "retry-statuses", retryStatuses))
+	sb.WriteString(fmt.Sprintf("  %-22s = %v\n", "safe", c.Safe))
+	sb.WriteString(fmt.Sprintf("  %-22s = %v\n", "skip-verify", c.SkipVerify))
+	sb.WriteString(fmt.Sprintf("  %-22s = %v\n", "stale-while-revalidate", c.StaleWhileRevalidate))
+	sb.WriteString(fmt.Sprintf("  %-22s = %v\n", "timeout", c.Timeout))
+	sb.WriteString(fmt.Sprintf("  %-22s = %v\n", "username", c.UserName))
+	sb.WriteString(fmt.Sprintf("  %-22s = %v\n", "wait", c.Wait))
 
 	return sb.String()
 }
@@ -0,0 +1,22 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfig_String(t *testing.T) {
+	result := Config{}.String()
+
+	assert.Contains(t, result, "  breaker-cooldown       = 30s\n")
+	assert.Contains(t, result, "  host-cooldown          = 30s\n")
+	assert.Contains(t, result, "  max-wait               = 30s\n")
+	assert.Contains(t, result, "  retry-statuses         = [500 502 503 504]\n")
+
+	result = Config{BreakerCooldown: time.Minute, RetryStatuses: []int{503}}.String()
+
+	assert.Contains(t, result, "  breaker-cooldown       = 1m0s\n")
+	assert.Contains(t, result, "  retry-statuses         = [503]\n")
+}
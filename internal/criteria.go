@@ -0,0 +1,192 @@
+package internal
+
+import (
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	queryFormatExact  = "Exact"
+	queryFormatRegexp = "Regexp"
+)
+
+// Criteria holds the optional CCP query parameters used to look up an account.
+type Criteria struct {
+	Address     string `json:"address,omitempty"`
+	Database    string `json:"database,omitempty"`
+	Folder      string `json:"folder,omitempty"`
+	PolicyID    string `json:"policy-id,omitempty"` //nolint:tagliatelle
+	Query       string `json:"query,omitempty"`
+	QueryFormat string `json:"query-format,omitempty"` //nolint:tagliatelle
+	UserName    string `json:"username,omitempty"`
+}
+
+func (c Criteria) Overwrite(other Criteria) Criteria {
+	for _, field := range c.fields() {
+		if value := *other.field(field.name); value != "" {
+			*field.value = value
+		}
+	}
+
+	return c
+}
+
+func (c Criteria) empty() bool {
+	return c == Criteria{}
+}
+
+func (c Criteria) set(values url.Values) {
+	for _, field := range c.fields() {
+		if *field.value != "" {
+			values.Set(field.name, *field.value)
+		}
+	}
+}
+
+func (c Criteria) validQueryFormat() bool {
+	return c.QueryFormat == "" ||
+		strings.EqualFold(c.QueryFormat, queryFormatExact) ||
+		strings.EqualFold(c.QueryFormat, queryFormatRegexp)
+}
+
+type criteriaField struct {
+	name  string
+	value *string
+}
+
+// fields returns the criteria keyed by their CCP query parameter name.
+func (c *Criteria) fields() []criteriaField {
+	return []criteriaField{
+		{name: "Address", value: &c.Address},
+		{name: "Database", value: &c.Database},
+		{name: "Folder", value: &c.Folder},
+		{name: "PolicyID", value: &c.PolicyID},
+		{name: "Query", value: &c.Query},
+		{name: "QueryFormat", value: &c.QueryFormat},
+		{name: "UserName", value: &c.UserName},
+	}
+}
+
+func (c *Criteria) field(name string) *string {
+	for _, field := range c.fields() {
+		if strings.EqualFold(field.name, name) {
+			return field.value
+		}
+	}
+
+	return nil
+}
+
+// reference identifies an account as written by the user: an object name optionally prefixed by
+// a configuration and followed by criteria, e.g. "prod-db/OBJECT?UserName=admin&Folder=Root".
+type reference struct {
+	config   string
+	name     string // reference without its configuration, used as cache key
+	object   string
+	criteria Criteria
+}
+
+// Query identifies an account to get: an object or criteria, of another configuration if any.
+type Query struct {
+	Criteria
+
+	Config string
+	Object string
+}
+
+// String returns the query as a reference, e.g. "prod-db/OBJECT?UserName=admin".
+func (q Query) String() string {
+	result := q.Object
+
+	if q.Config != "" {
+		result = q.Config + "/" + result
+	}
+
+	values := url.Values{}
+
+	q.Criteria.set(values)
+
+	if len(values) > 0 {
+		result += "?" + values.Encode()
+	}
+
+	return result
+}
+
+// newAccount returns the account to fetch for the query.
+func (q Query) newAccount(now time.Time) *Account {
+	ref := reference{
+		config:   q.Config,
+		name:     Query{Criteria: q.Criteria, Object: q.Object}.String(),
+		object:   q.Object,
+		criteria: q.Criteria,
+	}
+
+	return &Account{
+		Object:    q.String(),
+		Error:     ref.validate(q.String()),
+		Timestamp: now,
+		ref:       ref,
+	}
+}
+
+// parsePlaceholderReference parses the reference of a placeholder, whose object can be prefixed by the name of
+// another configuration, e.g. "prod-db/OBJECT?UserName=admin".
+func parsePlaceholderReference(s string) (reference, error) {
+	object, _, _ := strings.Cut(s, "?")
+
+	config, _, hasConfig := strings.Cut(object, "/")
+	if !hasConfig {
+		return parseReference(s)
+	}
+
+	if config == "" {
+		return reference{name: s}, NewError(nil, "empty config in %q", s)
+	}
+
+	result, err := parseReference(strings.TrimPrefix(s, config+"/"))
+	result.config = config
+
+	return result, err
+}
+
+// parseReference parses the reference of an account of the configuration, e.g. "OBJECT?UserName=admin",
+// the object name being possibly empty or containing slashes.
+func parseReference(s string) (reference, error) {
+	result := reference{name: s}
+
+	object, rawQuery, found := strings.Cut(s, "?")
+
+	result.object = object
+
+	if found {
+		values, err := url.ParseQuery(rawQuery)
+		if err != nil {
+			return result, NewError(err, "invalid criteria in %q", s)
+		}
+
+		for name, value := range values {
+			field := result.criteria.field(name)
+			if field == nil {
+				return result, NewError(nil, "unknown criteria %q in %q", name, s)
+			}
+
+			*field = value[len(value)-1]
+		}
+	}
+
+	return result, result.validate(s)
+}
+
+func (ref reference) validate(s string) error {
+	if ref.object == "" && ref.criteria.empty() {
+		return NewError(nil, "either an object or criteria are required in %q", s)
+	}
+
+	if !ref.criteria.validQueryFormat() {
+		return NewError(nil, "invalid query format %q in %q", ref.criteria.QueryFormat, s)
+	}
+
+	return nil
+}
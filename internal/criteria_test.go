@@ -0,0 +1,146 @@
+package internal
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCriteria_Overwrite(t *testing.T) {
+	c := Criteria{
+		Folder:   "Root",
+		UserName: "user",
+	}
+
+	assert.Equal(
+		t,
+		Criteria{
+			Address:  "address",
+			Folder:   "Root",
+			UserName: "admin",
+		},
+		c.Overwrite(Criteria{Address: "address", UserName: "admin"}),
+	)
+	assert.Equal(t, Criteria{Folder: "Root", UserName: "user"}, c)
+}
+
+func TestCriteria_set(t *testing.T) {
+	values := url.Values{}
+
+	Criteria{
+		Address:     "address",
+		Database:    "database",
+		Folder:      "folder",
+		PolicyID:    "policyId",
+		Query:       "query",
+		QueryFormat: "Regexp",
+		UserName:    "userName",
+	}.set(values)
+
+	assert.Equal(
+		t,
+		url.Values{
+			"Address":     []string{"address"},
+			"Database":    []string{"database"},
+			"Folder":      []string{"folder"},
+			"PolicyID":    []string{"policyId"},
+			"Query":       []string{"query"},
+			"QueryFormat": []string{"Regexp"},
+			"UserName":    []string{"userName"},
+		},
+		values,
+	)
+}
+
+func Test_parseReference(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    reference
+		wantErr bool
+	}{
+		{
+			name: "object",
+			s:    "object",
+			want: reference{name: "object", object: "object"},
+		},
+		{
+			name: "slash",
+			s:    "a/b?UserName=admin",
+			want: reference{
+				name:     "a/b?UserName=admin",
+				object:   "a/b",
+				criteria: Criteria{UserName: "admin"},
+			},
+		},
+		{
+			name: "object with criteria",
+			s:    "object?username=admin&Folder=Root%5CSub",
+			want: reference{
+				name:     "object?username=admin&Folder=Root%5CSub",
+				object:   "object",
+				criteria: Criteria{Folder: `Root\Sub`, UserName: "admin"},
+			},
+		},
+		{
+			name: "criteria only",
+			s:    "?Query=Address%3Ddb1&QueryFormat=Exact",
+			want: reference{
+				name:     "?Query=Address%3Ddb1&QueryFormat=Exact",
+				criteria: Criteria{Query: "Address=db1", QueryFormat: "Exact"},
+			},
+		},
+		{
+			name:    "empty",
+			s:       "?",
+			wantErr: true,
+		},
+		{
+			name:    "unknown criteria",
+			s:       "object?Unknown=value",
+			wantErr: true,
+		},
+		{
+			name:    "invalid query format",
+			s:       "object?QueryFormat=Fuzzy",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseReference(tt.s)
+
+			if tt.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func Test_parsePlaceholderReference(t *testing.T) {
+	got, err := parsePlaceholderReference("config/object?UserName=admin")
+	require.NoError(t, err)
+	assert.Equal(
+		t,
+		reference{
+			config:   "config",
+			name:     "object?UserName=admin",
+			object:   "object",
+			criteria: Criteria{UserName: "admin"},
+		},
+		got,
+	)
+
+	got, err = parsePlaceholderReference("object?Query=Address%3Ddb1/prod")
+	require.NoError(t, err)
+	assert.Equal(t, reference{name: "object?Query=Address%3Ddb1/prod", object: "object", criteria: Criteria{Query: "Address=db1/prod"}}, got, "slash in criteria")
+
+	_, err = parsePlaceholderReference("/object")
+	require.Error(t, err, "empty config")
+}
@@ -0,0 +1,124 @@
+package internal
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"os"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	// PassphraseEnv holds the passphrase the cache key is derived from, taking precedence over key files.
+	PassphraseEnv = "CAC_CACHE_PASSPHRASE"
+
+	keyInfo = "cac cache key"
+	saltLen = 16
+
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// KeySource is the secret the cache key of a configuration is derived from: a passphrase or the content of a file,
+// the client certificate private key by default.
+type KeySource struct {
+	Passphrase string
+	File       string
+}
+
+// NewKeySource returns the key source of the given configuration.
+func NewKeySource(cfg Config) KeySource {
+	if passphrase := os.Getenv(PassphraseEnv); passphrase != "" {
+		return KeySource{Passphrase: passphrase}
+	}
+
+	if cfg.CacheKeyFile != "" {
+		return KeySource{File: cfg.CacheKeyFile}
+	}
+
+	return KeySource{File: cfg.KeyFile}
+}
+
+func (ks KeySource) derive(salt []byte) (cacheKey, error) {
+	key := make([]byte, chacha20poly1305.KeySize)
+
+	switch {
+	case ks.Passphrase != "":
+		var err error
+
+		key, err = scrypt.Key([]byte(ks.Passphrase), salt, scryptN, scryptR, scryptP, chacha20poly1305.KeySize)
+		if err != nil {
+			return cacheKey{}, err
+		}
+	case ks.File != "":
+		secret, err := os.ReadFile(ks.File)
+		if err != nil {
+			return cacheKey{}, NewError(err, "failed to read cache key file")
+		}
+
+		if _, err = io.ReadFull(hkdf.New(sha256.New, secret, salt, []byte(keyInfo)), key); err != nil {
+			return cacheKey{}, err
+		}
+	default:
+		return cacheKey{}, NewError(nil, "either a passphrase or a key file is required to encrypt the cache")
+	}
+
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return cacheKey{}, err
+	}
+
+	return cacheKey{aead: aead}, nil
+}
+
+// cacheKey encrypts cached values, each one being bound to the configuration, name and column it is stored in.
+type cacheKey struct {
+	aead cipher.AEAD
+}
+
+func (k cacheKey) seal(plaintext, aad string) (string, error) {
+	nonce := make([]byte, k.aead.NonceSize(), k.aead.NonceSize()+len(plaintext)+k.aead.Overhead())
+
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(k.aead.Seal(nonce, nonce, []byte(plaintext), []byte(aad))), nil
+}
+
+func (k cacheKey) open(ciphertext, aad string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", err
+	}
+
+	if len(data) < k.aead.NonceSize() {
+		return "", NewError(nil, "invalid ciphertext")
+	}
+
+	plaintext, err := k.aead.Open(nil, data[:k.aead.NonceSize()], data[k.aead.NonceSize():], []byte(aad))
+	if err != nil {
+		return "", err
+	}
+
+	return string(plaintext), nil
+}
+
+// aad returns the additional data binding an encrypted column to its row.
+func aad(config, name, column string) string {
+	return config + "\x00" + name + "\x00" + column
+}
+
+func newSalt() ([]byte, error) {
+	result := make([]byte, saltLen)
+
+	_, err := rand.Read(result)
+
+	return result, err
+}
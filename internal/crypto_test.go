@@ -0,0 +1,67 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewKeySource(t *testing.T) {
+	t.Setenv(PassphraseEnv, "")
+
+	assert.Equal(t, KeySource{File: "key.pem"}, NewKeySource(Config{KeyFile: "key.pem"}))
+	assert.Equal(
+		t,
+		KeySource{File: "cache.key"},
+		NewKeySource(Config{CacheKeyFile: "cache.key", KeyFile: "key.pem"}),
+	)
+
+	t.Setenv(PassphraseEnv, "secret")
+
+	assert.Equal(
+		t,
+		KeySource{Passphrase: "secret"},
+		NewKeySource(Config{CacheKeyFile: "cache.key", KeyFile: "key.pem"}),
+	)
+}
+
+func TestKeySource_derive(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "cache.key")
+	require.NoError(t, os.WriteFile(file, []byte("key"), rw))
+
+	salt := []byte("0123456789abcdef")
+
+	for _, ks := range []KeySource{{Passphrase: "secret"}, {File: file}} {
+		key, err := ks.derive(salt)
+		require.NoError(t, err)
+
+		ciphertext, err := key.seal("value", aad("config", "name", valueColumn))
+		require.NoError(t, err)
+		assert.NotContains(t, ciphertext, "value")
+
+		sameKey, err := ks.derive(salt)
+		require.NoError(t, err)
+
+		plaintext, err := sameKey.open(ciphertext, aad("config", "name", valueColumn))
+		require.NoError(t, err)
+		assert.Equal(t, "value", plaintext)
+
+		_, err = sameKey.open(ciphertext, aad("config", "other", valueColumn))
+		require.Error(t, err)
+
+		otherKey, err := ks.derive([]byte("fedcba9876543210"))
+		require.NoError(t, err)
+
+		_, err = otherKey.open(ciphertext, aad("config", "name", valueColumn))
+		require.Error(t, err)
+	}
+
+	_, err := KeySource{}.derive(salt)
+	require.Error(t, err)
+
+	_, err = KeySource{File: filepath.Join(t.TempDir(), "missing")}.derive(salt)
+	require.Error(t, err)
+}
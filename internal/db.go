@@ -2,27 +2,110 @@ package internal
 
 import (
 	"database/sql"
-	"net/http"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
+
+	_ "github.com/mattn/go-sqlite3" // registers the SQLite driver
 )
 
-const driverName = "sqlite3"
+const (
+	driverName  = "sqlite3"
+	busyTimeout = 30_000 // ms
+	saltName    = "salt"
+
+	valueColumn      = "value"
+	propertiesColumn = "properties"
+)
 
+// DBCache stores accounts in SQLite, values and properties being encrypted with the key of their configuration.
 type DBCache struct {
-	db *sql.DB
+	db   *sql.DB
+	keys map[string]cacheKey
+}
+
+// row is an account as stored, possibly encrypted, with the metadata of its fetch and use.
+type row struct {
+	name, value, properties string
+	createdAt, expiresAt    int64
+	encrypted               bool
+	host                    string
+	status, tries, hits     int
+	accessedAt              int64
+}
+
+// migrations upgrade the schema step by step, the user_version of the database being the number of steps applied.
+// Columns are added only if missing, previous versions having added some without a schema version.
+//
+//nolint:gochecknoglobals
+var migrations = []func(tx *sql.Tx) error{
+	func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+			create table if not exists account (
+			    config     text not null,
+			    name       text not null,
+			    value      text not null,
+			    created_at int  not null,
+			    primary key (config, name)
+			) strict
+		`)
+
+		return err
+	},
+	func(tx *sql.Tx) error {
+		return addColumn(tx, "account", "properties", "text not null default '{}'")
+	},
+	func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`
+			create table if not exists setting (
+			    name  text not null primary key,
+			    value blob not null
+			) strict
+		`); err != nil {
+			return err
+		}
+
+		return addColumn(tx, "account", "encrypted", "int not null default 0")
+	},
+	func(tx *sql.Tx) error {
+		return addColumn(tx, "account", "expires_at", "int not null default 0")
+	},
+	func(tx *sql.Tx) error {
+		for _, column := range []struct{ name, definition string }{
+			{"host", "text not null default ''"},
+			{"status", "int not null default 200"},
+			{"tries", "int not null default 0"},
+			{"accessed_at", "int not null default 0"},
+			{"hits", "int not null default 0"},
+		} {
+			if err := addColumn(tx, "account", column.name, column.definition); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	},
 }
 
 func NewDBCache() (DBCache, error) {
-	var result DBCache
+	result := DBCache{keys: make(map[string]cacheKey)}
 
 	home, err := GetStateHome()
 	if err != nil {
 		return result, err
 	}
 
-	result.db, err = sql.Open(driverName, filepath.Join(home, "accounts.sqlite"))
+	// concurrent processes wait for each other instead of failing with "database is locked", write transactions
+	// taking the lock up front, while readers are not blocked by writers
+	result.db, err = sql.Open(
+		driverName,
+		"file:"+filepath.Join(home, "accounts.sqlite")+"?_busy_timeout="+strconv.Itoa(busyTimeout)+
+			"&_journal_mode=WAL&_txlock=immediate",
+	)
 	if err != nil {
 		return result, err
 	}
@@ -61,98 +144,332 @@ func (c DBCache) Configs(prefix string) ([]string, error) {
 	return result, nil
 }
 
+func (c DBCache) Remove(config string, names ...string) error {
+	for _, name := range names {
+		if _, err := c.db.Exec("delete from account where config = ? and name = ?", config, name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (c DBCache) RemoveAll(config string) error {
 	_, err := c.db.Exec("delete from account where config = ?", config)
 
 	return err
 }
 
-func (c DBCache) SortedAccounts(config, prefix string, exclusions []string) ([]Account, error) {
-	rows, err := c.db.Query("select name, value, created_at from account where config = ? order by name", config)
+// Unlock derives the key of the given configuration, encrypting the rows of a previous version stored in plaintext.
+func (c DBCache) Unlock(config string, source KeySource) error {
+	salt, err := c.salt()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	defer rows.Close()
+	key, err := source.derive(salt)
+	if err != nil {
+		return err
+	}
 
-	var result []Account
+	if _, err = c.rewrite(config, key, func(r row) (row, bool, error) {
+		return r, !r.encrypted, nil
+	}); err != nil {
+		return err
+	}
 
-	for rows.Next() {
-		var (
-			acct      Account
-			createdAt int64
-		)
+	c.keys[config] = key
+
+	return nil
+}
+
+// Rekey encrypts again the rows of the given configuration with the current key, returning how many were.
+// Rows already encrypted with the current key are left as is, so that an interrupted rekey can be run again.
+func (c DBCache) Rekey(config string, old, current KeySource) (int, error) {
+	salt, err := c.salt()
+	if err != nil {
+		return 0, err
+	}
+
+	oldKey, err := old.derive(salt)
+	if err != nil {
+		return 0, err
+	}
+
+	key, err := current.derive(salt)
+	if err != nil {
+		return 0, err
+	}
 
-		err = rows.Scan(&acct.Object, &acct.Value, &createdAt)
+	result, err := c.rewrite(config, key, func(r row) (row, bool, error) {
+		if !r.encrypted {
+			return r, true, nil
+		}
+
+		if _, err := key.open(r.value, aad(config, r.name, valueColumn)); err == nil {
+			return r, false, nil
+		}
+
+		plain, err := decrypt(oldKey, config, r)
 		if err != nil {
-			return nil, err
+			return r, false, NewError(err, "failed to decrypt %s with the old key", r.name)
 		}
 
-		acct.Timestamp = time.Unix(createdAt, 0)
+		return plain, true, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	c.keys[config] = key
+
+	return result, nil
+}
+
+// Import caches the accounts of the given bundle, under its configuration which must be unlocked.
+// Accounts already cached with a more recent value are kept.
+func (c DBCache) Import(bundle Bundle) error {
+	if _, found := c.keys[bundle.Config]; !found {
+		return NewError(nil, "cache of %q is locked", bundle.Config)
+	}
+
+	return c.merge(bundle.Config, bundle.accounts)
+}
+
+// SortedAccounts returns the cached accounts of a configuration, their values being empty unless it is unlocked.
+// Accounts which cannot be decrypted are returned with their error.
+func (c DBCache) SortedAccounts(config, prefix string, exclusions []string) ([]Account, error) {
+	rows, err := c.rows(config)
+	if err != nil {
+		return nil, err
+	}
+
+	key, unlocked := c.keys[config]
+
+	var result []Account
 
-		lowerName := strings.ToLower(acct.Object)
+	for _, r := range rows {
+		lowerName := strings.ToLower(r.name)
 
-		if (prefix == "" || strings.HasPrefix(lowerName, prefix)) &&
-			!ContainsFunc(exclusions, func(s string) bool {
+		if (prefix != "" && !strings.HasPrefix(lowerName, prefix)) ||
+			ContainsFunc(exclusions, func(s string) bool {
 				return strings.ToLower(s) == lowerName
 			}) {
-			result = append(result, acct)
+			continue
 		}
+
+		acct := r.account()
+
+		if unlocked {
+			decrypted, err := toAccount(key, config, r)
+			if err != nil {
+				// e.g. encrypted with an old key, reported without failing the other accounts
+				acct.Error = NewError(err, "failed to decrypt %s", r.name)
+			} else {
+				acct = decrypted
+			}
+		}
+
+		result = append(result, acct)
 	}
 
 	return result, nil
 }
 
+// init applies the migrations the database is missing.
 func (c DBCache) init() error {
-	_, err := c.db.Exec(`
-		create table if not exists account (
-		    config     text not null,
-		    name       text not null,
-		    value      text not null,
-		    created_at int  not null,
-		    primary key (config, name)
-		) strict
-	`)
+	var version int
 
-	return err
+	if err := c.db.QueryRow("pragma user_version").Scan(&version); err != nil {
+		return err
+	}
+
+	for ; version < len(migrations); version++ {
+		if err := c.migrate(version); err != nil {
+			return NewError(err, "failed to migrate cache to version %d", version+1)
+		}
+	}
+
+	return nil
 }
 
-func (c DBCache) clean(clock clock, expiry time.Duration) error {
-	minCreatedDate := clock.now().Add(expiry * -1)
+func (c DBCache) migrate(version int) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = tx.Rollback()
+	}()
 
-	_, err := c.db.Exec("delete from account where created_at < ?", minCreatedDate)
+	// migrated by another process meanwhile
+	var current int
+
+	if err = tx.QueryRow("pragma user_version").Scan(&current); err != nil || current > version {
+		return err
+	}
+
+	if err = migrations[version](tx); err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec(fmt.Sprintf("pragma user_version = %d", version+1)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// salt returns the salt used to derive every key, generated on first use.
+func (c DBCache) salt() ([]byte, error) {
+	var result []byte
+
+	err := c.db.QueryRow("select value from setting where name = ?", saltName).Scan(&result)
+	if err == nil || !errors.Is(err, sql.ErrNoRows) {
+		return result, err
+	}
+
+	if result, err = newSalt(); err != nil {
+		return nil, err
+	}
+
+	if _, err = c.db.Exec(
+		"insert into setting (name, value) values(?, ?) on conflict do nothing",
+		saltName,
+		result,
+	); err != nil {
+		return nil, err
+	}
+
+	// another process may have generated it meanwhile
+	err = c.db.QueryRow("select value from setting where name = ?", saltName).Scan(&result)
+
+	return result, err
+}
+
+// addColumn adds the given column to a table created by a previous version, if missing.
+func addColumn(tx *sql.Tx, table, column, definition string) error {
+	var count int
+
+	if err := tx.QueryRow(
+		"select count(*) from pragma_table_info(?) where name = ?",
+		table,
+		column,
+	).Scan(&count); err != nil {
+		return err
+	}
+
+	if count > 0 {
+		return nil
+	}
+
+	_, err := tx.Exec("alter table " + table + " add column " + column + " " + definition)
 
 	return err
 }
 
+// clean deletes the accounts of a configuration which expired before the given date, returning how many were.
+func (c DBCache) clean(config string, before time.Time) (int, error) {
+	res, err := c.db.Exec("delete from account where config = ? and expires_at < ?", config, before.Unix())
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := res.RowsAffected()
+
+	return int(result), err
+}
+
 func (c DBCache) get(config, name string) (Account, error) {
-	result := Account{
-		Object:     name,
-		StatusCode: http.StatusOK,
+	key, found := c.keys[config]
+	if !found {
+		return Account{}, NewError(nil, "cache of %q is locked", config)
+	}
+
+	r, err := scanRow(c.db.QueryRow("select "+rowColumns+" from account where config = ? and name = ?", config, name))
+	if err != nil {
+		return Account{}, err
 	}
 
-	row := c.db.QueryRow("select value, created_at from account where config = ? and name = ?",
+	r.name = name
+
+	return toAccount(key, config, r)
+}
+
+// hit records that the cached account was used at the given time.
+func (c DBCache) hit(config, name string, at time.Time) error {
+	_, err := c.db.Exec(
+		"update account set hits = hits + 1, accessed_at = ? where config = ? and name = ?",
+		at.Unix(),
 		config,
 		name,
 	)
 
-	var createdAt int64
+	return err
+}
 
-	err := row.Scan(&result.Value, &createdAt)
+// merge caches the given accounts, under their own configuration if any or under the default one.
+// Failed accounts and accounts of a configuration that could not be unlocked are not cached.
+func (c DBCache) merge(defaultConfig string, accounts []Account) error {
+	for _, acct := range accounts {
+		if !acct.ok() {
+			continue
+		}
 
-	result.Timestamp = time.Unix(createdAt, 0)
+		config := acct.ref.config
+		if config == "" {
+			config = defaultConfig
+		}
 
-	return result, err
-}
+		key, found := c.keys[config]
+		if !found {
+			continue
+		}
 
-func (c DBCache) merge(config string, accounts []Account) error {
-	for _, acct := range accounts {
-		if _, err := c.db.Exec(
-			"insert into account (config, name, value, created_at) values(?, ?, ?, ?) on conflict do nothing",
+		properties, err := json.Marshal(acct.Properties)
+		if err != nil {
+			return err
+		}
+
+		r, err := encrypt(key, config, row{
+			name:       acct.ref.name,
+			value:      acct.Value,
+			properties: string(properties),
+			createdAt:  acct.Timestamp.Unix(),
+			expiresAt:  acct.expiresAt.Unix(),
+			host:       acct.Host,
+			status:     acct.StatusCode,
+			tries:      acct.Try,
+		})
+		if err != nil {
+			return err
+		}
+
+		// a row which could not be decrypted is replaced by the account fetched instead, while a row written since
+		// by another process is kept, timestamps being in seconds: an account refreshed within the same second wins
+		if _, err = c.db.Exec(`
+			insert into account (config, name, value, properties, created_at, expires_at, encrypted, host, status, tries)
+			values(?, ?, ?, ?, ?, ?, 1, ?, ?, ?)
+			on conflict do update set
+				value = excluded.value,
+				properties = excluded.properties,
+				created_at = excluded.created_at,
+				expires_at = excluded.expires_at,
+				encrypted = 1,
+				host = excluded.host,
+				status = excluded.status,
+				tries = excluded.tries
+			where excluded.created_at >= account.created_at`,
 			config,
-			acct.Object,
-			acct.Value,
-			acct.Timestamp.Unix(),
+			r.name,
+			r.value,
+			r.properties,
+			r.createdAt,
+			r.expiresAt,
+			r.host,
+			r.status,
+			r.tries,
 		); err != nil {
 			return err
 		}
@@ -160,3 +477,158 @@ func (c DBCache) merge(config string, accounts []Account) error {
 
 	return nil
 }
+
+func (c DBCache) rows(config string) ([]row, error) {
+	rows, err := c.db.Query("select name, "+rowColumns+" from account where config = ? order by name", config)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var result []row
+
+	for rows.Next() {
+		var name string
+
+		r, err := scanRow(rows, &name)
+		if err != nil {
+			return nil, err
+		}
+
+		r.name = name
+		result = append(result, r)
+	}
+
+	return result, rows.Err()
+}
+
+// rewrite encrypts with the given key the rows of a configuration selected by plain, which returns them decrypted.
+func (c DBCache) rewrite(config string, key cacheKey, plain func(r row) (row, bool, error)) (int, error) {
+	rows, err := c.rows(config)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := c.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	result := 0
+
+	for _, r := range rows {
+		r, selected, err := plain(r)
+		if err != nil {
+			return 0, err
+		}
+
+		if !selected {
+			continue
+		}
+
+		if r, err = encrypt(key, config, r); err != nil {
+			return 0, err
+		}
+
+		if _, err = tx.Exec(
+			"update account set value = ?, properties = ?, encrypted = 1 where config = ? and name = ?",
+			r.value,
+			r.properties,
+			config,
+			r.name,
+		); err != nil {
+			return 0, err
+		}
+
+		result++
+	}
+
+	return result, tx.Commit()
+}
+
+// rowColumns are the columns read by scanRow, the name excepted.
+const rowColumns = "value, properties, created_at, expires_at, encrypted, host, status, tries, accessed_at, hits"
+
+// scanRow reads a row selected with rowColumns, after the given leading columns if any.
+func scanRow(scanner interface{ Scan(dest ...any) error }, leading ...any) (row, error) {
+	var r row
+
+	err := scanner.Scan(append(
+		leading,
+		&r.value, &r.properties, &r.createdAt, &r.expiresAt, &r.encrypted, &r.host, &r.status, &r.tries, &r.accessedAt, &r.hits,
+	)...)
+
+	return r, err
+}
+
+// account returns the account of the row, without its value and properties which may be encrypted.
+func (r row) account() Account {
+	result := Account{
+		Object:     r.name,
+		Try:        r.tries,
+		StatusCode: r.status,
+		Timestamp:  time.Unix(r.createdAt, 0),
+		Host:       r.host,
+		Hits:       r.hits,
+		expiresAt:  time.Unix(r.expiresAt, 0),
+	}
+
+	if r.accessedAt > 0 {
+		result.AccessedAt = time.Unix(r.accessedAt, 0)
+	}
+
+	return result
+}
+
+func encrypt(key cacheKey, config string, r row) (row, error) {
+	var err error
+
+	if r.value, err = key.seal(r.value, aad(config, r.name, valueColumn)); err != nil {
+		return r, err
+	}
+
+	if r.properties, err = key.seal(r.properties, aad(config, r.name, propertiesColumn)); err != nil {
+		return r, err
+	}
+
+	r.encrypted = true
+
+	return r, nil
+}
+
+func decrypt(key cacheKey, config string, r row) (row, error) {
+	if !r.encrypted {
+		return r, nil
+	}
+
+	var err error
+
+	if r.value, err = key.open(r.value, aad(config, r.name, valueColumn)); err != nil {
+		return r, NewError(err, "failed to decrypt, was the cache key changed without rekey?")
+	}
+
+	if r.properties, err = key.open(r.properties, aad(config, r.name, propertiesColumn)); err != nil {
+		return r, NewError(err, "failed to decrypt, was the cache key changed without rekey?")
+	}
+
+	r.encrypted = false
+
+	return r, nil
+}
+
+func toAccount(key cacheKey, config string, r row) (Account, error) {
+	r, err := decrypt(key, config, r)
+	if err != nil {
+		return Account{}, err
+	}
+
+	result := r.account()
+	result.Value = r.value
+
+	return result, json.Unmarshal([]byte(r.properties), &result.Properties)
+}
@@ -0,0 +1,234 @@
+package internal
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestCache(t *testing.T) DBCache {
+	t.Helper()
+
+	t.Setenv(xdgStateHome, t.TempDir())
+
+	result, err := NewDBCache()
+	require.NoError(t, err)
+
+	t.Cleanup(result.Close)
+
+	return result
+}
+
+func newCachedAccount(object, value string) Account {
+	result := *newPlaceholderAccount(object, now)
+
+	result.Value = value
+	result.Properties = map[string]string{"UserName": "user of " + object}
+	result.StatusCode = 200
+	result.expiresAt = now.Add(time.Hour)
+
+	return result
+}
+
+func TestDBCache_init_legacy(t *testing.T) {
+	home := t.TempDir()
+
+	t.Setenv(xdgStateHome, home)
+
+	stateHome, err := GetStateHome()
+	require.NoError(t, err)
+
+	// schema of the first version
+	db, err := sql.Open(driverName, filepath.Join(stateHome, "accounts.sqlite"))
+	require.NoError(t, err)
+
+	_, err = db.Exec(`
+		create table account (
+		    config     text not null,
+		    name       text not null,
+		    value      text not null,
+		    created_at int  not null,
+		    primary key (config, name)
+		) strict
+	`)
+	require.NoError(t, err)
+
+	_, err = db.Exec("insert into account (config, name, value, created_at) values('test', 'o1', 'plain', ?)", now.Unix())
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	for range 2 {
+		cache, err := NewDBCache()
+		require.NoError(t, err)
+
+		var version int
+
+		require.NoError(t, cache.db.QueryRow("pragma user_version").Scan(&version))
+		assert.Len(t, migrations, version)
+
+		require.NoError(t, cache.Unlock("test", KeySource{File: newTestKeyFile(t)}))
+
+		acct, err := cache.get("test", "o1")
+		require.NoError(t, err)
+		assert.Equal(t, "plain", acct.Value)
+		assert.Equal(t, 200, acct.StatusCode)
+
+		cache.Close()
+	}
+}
+
+func TestDBCache_metadata(t *testing.T) {
+	cache := newTestCache(t)
+
+	require.NoError(t, cache.Unlock("test", KeySource{File: newTestKeyFile(t)}))
+
+	acct := newCachedAccount("o1", "value1")
+	acct.Host = "ccp.example.com"
+	acct.Try = 2
+
+	require.NoError(t, cache.merge("test", []Account{acct}))
+
+	accounts, err := cache.SortedAccounts("test", "", nil)
+	require.NoError(t, err)
+	require.Len(t, accounts, 1)
+	assert.Equal(t, 0, accounts[0].Hits)
+	assert.True(t, accounts[0].AccessedAt.IsZero())
+
+	_, err = cache.get("test", "o1")
+	require.NoError(t, err)
+
+	for range 2 {
+		require.NoError(t, cache.hit("test", "o1", now))
+	}
+
+	accounts, err = cache.SortedAccounts("test", "", nil)
+	require.NoError(t, err)
+	require.Len(t, accounts, 1)
+	assert.Equal(t, "ccp.example.com", accounts[0].Host)
+	assert.Equal(t, 2, accounts[0].Try)
+	assert.Equal(t, 2, accounts[0].Hits, "get is not a hit")
+	assert.Equal(t, now, accounts[0].AccessedAt.UTC())
+}
+
+func TestDBCache_encrypted(t *testing.T) {
+	cache := newTestCache(t)
+	source := KeySource{File: newTestKeyFile(t)}
+
+	require.NoError(t, cache.Unlock("test", source))
+	require.NoError(t, cache.merge("test", []Account{newCachedAccount("o1", "secret value")}))
+
+	var value, properties string
+
+	require.NoError(t, cache.db.QueryRow(
+		"select value, properties from account where config = 'test' and name = 'o1'",
+	).Scan(&value, &properties))
+	assert.NotContains(t, value, "secret")
+	assert.NotContains(t, properties, "user")
+
+	acct, err := cache.get("test", "o1")
+	require.NoError(t, err)
+	assert.Equal(t, "secret value", acct.Value)
+	assert.Equal(t, map[string]string{"UserName": "user of o1"}, acct.Properties)
+
+	_, err = cache.get("other", "o1")
+	require.Error(t, err, "locked")
+
+	require.NoError(t, cache.Unlock("test", KeySource{Passphrase: "other"}))
+
+	_, err = cache.get("test", "o1")
+	require.Error(t, err, "wrong key")
+
+	require.NoError(t, cache.merge("test", []Account{newCachedAccount("o2", "other value")}))
+
+	accounts, err := cache.SortedAccounts("test", "", nil)
+	require.NoError(t, err, "accounts of the wrong key reported only")
+	require.Len(t, accounts, 2)
+	require.Error(t, accounts[0].Error)
+	assert.Equal(t, "o1", accounts[0].Object)
+	require.NoError(t, accounts[1].Error)
+	assert.Equal(t, "other value", accounts[1].Value)
+
+	// the account fetched again replaces the one that cannot be decrypted anymore
+	acct = newCachedAccount("o1", "new value")
+	acct.Timestamp = now.Add(time.Minute)
+
+	require.NoError(t, cache.merge("test", []Account{acct}))
+
+	acct, err = cache.get("test", "o1")
+	require.NoError(t, err)
+	assert.Equal(t, "new value", acct.Value)
+}
+
+func TestDBCache_Remove(t *testing.T) {
+	cache := newTestCache(t)
+
+	require.NoError(t, cache.Unlock("test", KeySource{File: newTestKeyFile(t)}))
+	require.NoError(t, cache.merge("test", []Account{
+		newCachedAccount("o1", "value1"),
+		newCachedAccount("o2", "value2"),
+		newCachedAccount("o3", "value3"),
+	}))
+
+	require.NoError(t, cache.Remove("test", "o1", "o3"))
+
+	accounts, err := cache.SortedAccounts("test", "", nil)
+	require.NoError(t, err)
+	require.Len(t, accounts, 1)
+	assert.Equal(t, "o2", accounts[0].Object)
+}
+
+func TestDBCache_Unlock_plaintext(t *testing.T) {
+	cache := newTestCache(t)
+
+	_, err := cache.db.Exec(
+		"insert into account (config, name, value, properties, created_at) values('test', 'o1', 'plain', '{}', ?)",
+		now.Unix(),
+	)
+	require.NoError(t, err)
+
+	require.NoError(t, cache.Unlock("test", KeySource{File: newTestKeyFile(t)}))
+
+	var value string
+
+	require.NoError(t, cache.db.QueryRow("select value from account where name = 'o1'").Scan(&value))
+	assert.NotEqual(t, "plain", value)
+
+	acct, err := cache.get("test", "o1")
+	require.NoError(t, err)
+	assert.Equal(t, "plain", acct.Value)
+}
+
+func TestDBCache_Rekey(t *testing.T) {
+	cache := newTestCache(t)
+	old := KeySource{File: newTestKeyFile(t)}
+	current := KeySource{Passphrase: "new passphrase"}
+
+	require.NoError(t, cache.Unlock("test", old))
+	require.NoError(t, cache.merge("test", []Account{
+		newCachedAccount("o1", "value1"),
+		newCachedAccount("o2", "value2"),
+	}))
+
+	count, err := cache.Rekey("test", old, current)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	count, err = cache.Rekey("test", old, current)
+	require.NoError(t, err)
+	assert.Equal(t, 0, count, "already rekeyed")
+
+	require.NoError(t, cache.Unlock("test", current))
+
+	accounts, err := cache.SortedAccounts("test", "", nil)
+	require.NoError(t, err)
+	require.Len(t, accounts, 2)
+	assert.Equal(t, "value1", accounts[0].Value)
+	assert.Equal(t, "value2", accounts[1].Value)
+
+	_, err = cache.Rekey("test", KeySource{Passphrase: "wrong"}, KeySource{Passphrase: "newer"})
+	require.Error(t, err)
+}
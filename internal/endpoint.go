@@ -0,0 +1,97 @@
+package internal
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/url"
+)
+
+// endpoint is the CCP Web Service of a configuration, accounts of a single run being
+// possibly spread over several configurations.
+type endpoint struct {
+	name     string
+	config   Config
+	http     *http.Client
+	balancer *balancer
+	breaker  *breaker
+	limiter  *limiter
+}
+
+// newEndpoint returns the endpoint of the configuration, sending requests with the HTTP client returned by
+// newHTTPClient if any, authenticating with the client certificate of the configuration otherwise.
+func newEndpoint(name string, cfg Config, newHTTPClient func(cfg Config) (*http.Client, error)) (endpoint, error) {
+	if newHTTPClient == nil {
+		newHTTPClient = func(cfg Config) (*http.Client, error) {
+			return NewHTTPClient(cfg, nil)
+		}
+	}
+
+	httpClient, err := newHTTPClient(cfg)
+	if err != nil {
+		return endpoint{}, err
+	}
+
+	return newHTTPEndpoint(name, cfg, httpClient), nil
+}
+
+func newHTTPEndpoint(name string, cfg Config, httpClient *http.Client) endpoint {
+	return endpoint{
+		name:     name,
+		config:   cfg,
+		http:     httpClient,
+		balancer: newBalancer(cfg),
+		breaker:  newBreaker(cfg),
+		limiter:  newLimiter(cfg),
+	}
+}
+
+// NewHTTPClient returns an HTTP client of the CCP Web Service using the given TLS configuration,
+// or authenticating with the client certificate of the configuration if nil.
+func NewHTTPClient(cfg Config, tlsConfig *tls.Config) (*http.Client, error) {
+	if tlsConfig == nil {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		tlsConfig = &tls.Config{
+			Certificates:       []tls.Certificate{cert},
+			MinVersion:         tls.VersionTLS12,
+			Renegotiation:      tls.RenegotiateOnceAsClient,
+			InsecureSkipVerify: cfg.SkipVerify, //nolint:gosec
+		}
+	}
+
+	return &http.Client{
+		Timeout: cfg.Timeout,
+		Transport: &http.Transport{
+			MaxConnsPerHost: cfg.MaxConns,
+			Proxy:           nil,
+			TLSClientConfig: tlsConfig,
+		},
+	}, nil
+}
+
+func (ep endpoint) url(host string, values url.Values) *url.URL {
+	return &url.URL{
+		Scheme:   "https",
+		Host:     host,
+		Path:     "/AIMWebService/api/Accounts",
+		RawQuery: values.Encode(),
+	}
+}
+
+func (ep endpoint) query(ref reference) url.Values {
+	result := url.Values{}
+
+	result.Set("AppID", ep.config.AppID)
+	result.Set("Safe", ep.config.Safe)
+
+	if ref.object != "" {
+		result.Set("Object", ref.object)
+	}
+
+	ep.config.Criteria.Overwrite(ref.criteria).set(result)
+
+	return result
+}
@@ -0,0 +1,89 @@
+package internal
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_endpoint_query(t *testing.T) {
+	ep := endpoint{
+		config: Config{
+			AppID: "appId",
+			Safe:  "safe",
+		},
+	}
+
+	assert.Equal(
+		t,
+		url.Values{
+			"AppID":  []string{"appId"},
+			"Safe":   []string{"safe"},
+			"Object": []string{"o1"},
+		},
+		ep.query(reference{object: "o1"}),
+	)
+}
+
+func Test_endpoint_query_criteria(t *testing.T) {
+	ep := endpoint{
+		config: Config{
+			Criteria: Criteria{
+				Folder:   "Root",
+				UserName: "default",
+			},
+			AppID: "appId",
+			Safe:  "safe",
+		},
+	}
+
+	assert.Equal(
+		t,
+		url.Values{
+			"AppID":    []string{"appId"},
+			"Safe":     []string{"safe"},
+			"Folder":   []string{"Root"},
+			"UserName": []string{"admin"},
+			"Address":  []string{"db1"},
+		},
+		ep.query(reference{criteria: Criteria{Address: "db1", UserName: "admin"}}),
+	)
+}
+
+func Test_endpoint_url(t *testing.T) {
+	ep := endpoint{}
+
+	assert.Equal(
+		t,
+		&url.URL{
+			Scheme:   "https",
+			Host:     "host",
+			Path:     "/AIMWebService/api/Accounts",
+			RawQuery: "AppID=appId&Safe=safe",
+		},
+		ep.url(
+			"host",
+			url.Values{
+				"AppID": []string{"appId"},
+				"Safe":  []string{"safe"},
+			},
+		),
+	)
+}
+
+func Test_newEndpoint(t *testing.T) {
+	_, err := newEndpoint("test", Config{CertFile: "unknown.crt", KeyFile: "unknown.key"}, nil)
+
+	assert.Error(t, err)
+
+	httpClient := &http.Client{}
+	ep, err := newEndpoint("test", Config{}, func(Config) (*http.Client, error) {
+		return httpClient, nil
+	})
+
+	require.NoError(t, err)
+	assert.Same(t, httpClient, ep.http)
+}
@@ -17,3 +17,7 @@ func NewError(cause error, format string, args ...any) error {
 		Message: fmt.Sprintf(format, args...),
 	}
 }
+
+func (e *Error) Unwrap() error {
+	return e.Cause
+}
@@ -0,0 +1,146 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+// Exec runs the given command with the environment variables defined by --env and --env-file,
+// once every account has been resolved, and returns its exit code.
+func (c Client) Exec(ctx context.Context, name string, args []string) (int, error) {
+	requests, tmpl, err := c.readFromEnv()
+	if err != nil {
+		return 0, err
+	}
+
+	fetchCtx, cancel := c.withDeadline(ctx)
+	defer cancel()
+
+	accounts, err := c.fetch(fetchCtx, requests)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = c.ok(accounts); err != nil {
+		return 0, err
+	}
+
+	env, err := environment(tmpl, accountsByObject(accounts))
+	if err != nil {
+		return 0, err
+	}
+
+	cmd := exec.Command(name, args...)
+
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdin = c.stdin
+	cmd.Stdout = c.log.Writer()
+	cmd.Stderr = os.Stderr
+
+	defer c.wait()
+
+	return run(cmd)
+}
+
+// readFromEnv builds a template from the env file followed by the KEY=REFERENCE variables.
+func (c Client) readFromEnv() ([]*Account, template, error) {
+	sb := strings.Builder{}
+
+	if c.params.EnvFile != "" {
+		data, err := os.ReadFile(c.params.EnvFile)
+		if err != nil {
+			return nil, template{}, err
+		}
+
+		sb.Write(data)
+
+		if len(data) > 0 && data[len(data)-1] != '\n' {
+			sb.WriteRune('\n')
+		}
+	}
+
+	for _, env := range c.params.Env {
+		key, ref, found := strings.Cut(env, "=")
+		if !found || key == "" || ref == "" {
+			return nil, template{}, NewError(nil, "invalid environment variable %q, expected KEY=OBJECT", env)
+		}
+
+		sb.WriteString(key + "=" + placeholderStart + ref + placeholderEnd + "\n")
+	}
+
+	return c.readFromReader(strings.NewReader(sb.String()))
+}
+
+// environment returns the rendered KEY=VALUE lines of the template, ignoring empty lines and comments.
+// Lines are rendered one by one, so that values spanning several lines are kept whole.
+func environment(tmpl template, accounts map[string]*Account) ([]string, error) {
+	var result []string
+
+	for i, tl := range tmpl.lines {
+		line := strings.TrimRight(tl.render(accounts), "\r\n")
+
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, commentPrefix) {
+			continue
+		}
+
+		if key, _, found := strings.Cut(line, "="); !found || key == "" {
+			return nil, NewError(nil, "invalid environment variable at line %d, expected KEY=VALUE", i+1)
+		}
+
+		result = append(result, line)
+	}
+
+	return result, nil
+}
+
+// run starts the command, forwarding the signals received meanwhile, and waits for it to exit.
+func run(cmd *exec.Cmd) (int, error) {
+	signals := make(chan os.Signal, 1)
+
+	signal.Notify(signals, os.Interrupt, syscall.SIGHUP, syscall.SIGQUIT, syscall.SIGTERM)
+
+	defer signal.Stop(signals)
+
+	if err := cmd.Start(); err != nil {
+		return 0, err
+	}
+
+	done := make(chan struct{})
+
+	defer close(done)
+
+	go func() {
+		for {
+			select {
+			case sig := <-signals:
+				_ = cmd.Process.Signal(sig)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	err := cmd.Wait()
+
+	var exitErr *exec.ExitError
+
+	if errors.As(err, &exitErr) {
+		if code := exitErr.ExitCode(); code >= 0 {
+			return code, nil
+		}
+
+		// killed by a signal, exiting like a shell would
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			return 128 + int(status.Signal()), nil
+		}
+
+		return 1, nil
+	}
+
+	return 0, err
+}
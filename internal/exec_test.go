@@ -0,0 +1,136 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestExecClient(t *testing.T) Client {
+	t.Helper()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a POSIX shell")
+	}
+
+	client := newTestClient(
+		t,
+		func(w http.ResponseWriter, r *http.Request) {
+			object := r.URL.Query().Get("Object")
+
+			if object == "unknown" {
+				w.WriteHeader(http.StatusNotFound)
+			} else {
+				_, _ = fmt.Fprintf(w, "{\"Content\": \"value for %s\", \"UserName\": \"user of %s\"}\n", object, object)
+			}
+		},
+	)
+	client.params.MaxConns = 2
+	client.params.Objects = nil
+
+	return client
+}
+
+func TestClient_Exec(t *testing.T) {
+	client := newTestExecClient(t)
+	envFile := filepath.Join(t.TempDir(), "test.env")
+
+	require.NoError(t, os.WriteFile(envFile, []byte("# comment\n\nUSER=${CYBERARK:o1#UserName}\nHOST=localhost"), rw))
+
+	client.params.Env = []string{"PASSWORD=o1", "OTHER=o2"}
+	client.params.EnvFile = envFile
+	buf := captureOutput(client)
+
+	code, err := client.Exec(context.Background(), "sh", []string{"-c", `echo "$USER:$PASSWORD@$HOST $OTHER"; exit 3`})
+
+	require.NoError(t, err)
+	assert.Equal(t, 3, code)
+	assert.Equal(t, "user of o1:value for o1@localhost value for o2\n", buf.String())
+}
+
+func TestClient_Exec_Error(t *testing.T) {
+	client := newTestExecClient(t)
+
+	client.params.Env = []string{"PASSWORD=unknown"}
+	buf := captureOutput(client)
+
+	_, err := client.Exec(context.Background(), "sh", []string{"-c", "echo should not run"})
+
+	require.Error(t, err)
+	assert.Empty(t, buf.String())
+}
+
+func TestClient_readFromEnv(t *testing.T) {
+	client := Client{
+		clock: newFixedClock(),
+		params: Parameters{
+			Env: []string{"USER=o1#UserName", "PASSWORD=o1"},
+		},
+	}
+
+	accounts, tmpl, err := client.readFromEnv()
+
+	require.NoError(t, err)
+	require.Len(t, accounts, 1)
+	assert.Equal(t, "o1", accounts[0].Object)
+	assert.Len(t, tmpl.lines, 2)
+
+	client.params.Env = []string{"USER"}
+
+	_, _, err = client.readFromEnv()
+
+	require.Error(t, err)
+}
+
+func Test_environment(t *testing.T) {
+	tmpl, err := parseTemplate(strings.NewReader("# comment\n\nKEY=${CYBERARK:o1}\r\nOTHER=value\n"))
+	require.NoError(t, err)
+
+	env, err := environment(tmpl, map[string]*Account{
+		"o1": {Value: "multi\nline", StatusCode: http.StatusOK},
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"KEY=multi\nline", "OTHER=value"}, env)
+
+	tmpl, err = parseTemplate(strings.NewReader("INVALID\n"))
+	require.NoError(t, err)
+
+	_, err = environment(tmpl, nil)
+
+	require.Error(t, err)
+}
+
+func Test_run(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a POSIX shell")
+	}
+
+	code, err := run(exec.Command("sh", "-c", "exit 0"))
+
+	require.NoError(t, err)
+	assert.Zero(t, code)
+
+	code, err = run(exec.Command("sh", "-c", "exit 3"))
+
+	require.NoError(t, err)
+	assert.Equal(t, 3, code)
+
+	code, err = run(exec.Command("sh", "-c", "kill -KILL $$"))
+
+	require.NoError(t, err)
+	assert.Equal(t, 128+9, code, "killed by SIGKILL")
+
+	_, err = run(exec.Command(filepath.Join(t.TempDir(), "unknown")))
+
+	require.Error(t, err)
+}
@@ -0,0 +1,429 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	secretServiceName     = "org.freedesktop.secrets"
+	secretServicePath     = dbus.ObjectPath("/org/freedesktop/secrets")
+	defaultCollectionPath = dbus.ObjectPath("/org/freedesktop/secrets/aliases/default")
+	noPrompt              = dbus.ObjectPath("/")
+
+	secretServiceInterface = "org.freedesktop.Secret.Service"
+	collectionInterface    = "org.freedesktop.Secret.Collection"
+	itemInterface          = "org.freedesktop.Secret.Item"
+	sessionInterface       = "org.freedesktop.Secret.Session"
+	propertiesGet          = "org.freedesktop.DBus.Properties.Get"
+
+	applicationAttribute = "application"
+	configAttribute      = "config"
+	createdAtAttribute   = "created-at"
+	expiresAtAttribute   = "expires-at"
+	nameAttribute        = "name"
+	applicationName      = "cac"
+)
+
+// dbusCaller calls methods of the Secret Service objects, on the session bus or on a fake one when testing.
+type dbusCaller interface {
+	call(path dbus.ObjectPath, method string, args ...any) ([]any, error)
+	close() error
+}
+
+type sessionBus struct {
+	conn *dbus.Conn
+}
+
+func (b sessionBus) call(path dbus.ObjectPath, method string, args ...any) ([]any, error) {
+	call := b.conn.Object(secretServiceName, path).Call(method, 0, args...)
+
+	return call.Body, call.Err
+}
+
+func (b sessionBus) close() error {
+	return b.conn.Close()
+}
+
+// dbusSecret is the Secret structure of the Secret Service API.
+type dbusSecret struct {
+	Session     dbus.ObjectPath
+	Parameters  []byte
+	Value       []byte
+	ContentType string
+}
+
+// keyringSecret is the JSON content of an item, its configuration, name and creation date being attributes.
+type keyringSecret struct {
+	Value      string            `json:"value"`
+	Properties map[string]string `json:"properties,omitempty"`
+}
+
+// KeyringCache stores accounts as items of the default collection of the freedesktop Secret Service,
+// which encrypts them and unlocks them with the desktop session.
+type KeyringCache struct {
+	bus     dbusCaller
+	session dbus.ObjectPath
+}
+
+func NewKeyringCache() (KeyringCache, error) {
+	conn, err := dbus.SessionBusPrivateNoAutoStartup()
+	if err != nil {
+		return KeyringCache{}, NewError(err, "failed to connect to session bus")
+	}
+
+	if err = conn.Auth(nil); err != nil {
+		_ = conn.Close()
+
+		return KeyringCache{}, NewError(err, "failed to authenticate to session bus")
+	}
+
+	if err = conn.Hello(); err != nil {
+		_ = conn.Close()
+
+		return KeyringCache{}, NewError(err, "failed to connect to session bus")
+	}
+
+	return newKeyringCache(sessionBus{conn: conn})
+}
+
+func newKeyringCache(bus dbusCaller) (KeyringCache, error) {
+	result := KeyringCache{bus: bus}
+
+	// secrets are not encrypted in transit by a plain session, the session bus being private to the user
+	body, err := bus.call(secretServicePath, secretServiceInterface+".OpenSession", "plain", dbus.MakeVariant(""))
+	if err != nil {
+		_ = bus.close()
+
+		return result, NewError(err, "failed to open Secret Service session")
+	}
+
+	var output dbus.Variant
+
+	if err = dbus.Store(body, &output, &result.session); err != nil {
+		_ = bus.close()
+
+		return result, err
+	}
+
+	return result, nil
+}
+
+func (c KeyringCache) Close() {
+	_, _ = c.bus.call(c.session, sessionInterface+".Close")
+	_ = c.bus.close()
+}
+
+func (c KeyringCache) Configs(prefix string) ([]string, error) {
+	items, err := c.search(map[string]string{applicationAttribute: applicationName})
+	if err != nil {
+		return nil, err
+	}
+
+	var result []string
+
+	for _, item := range items {
+		attributes, err := c.attributes(item)
+		if err != nil {
+			return nil, err
+		}
+
+		config := attributes[configAttribute]
+
+		if strings.HasPrefix(strings.ToLower(config), strings.ToLower(prefix)) && !Contains(result, config) {
+			result = append(result, config)
+		}
+	}
+
+	sort.Strings(result)
+
+	return result, nil
+}
+
+func (c KeyringCache) Remove(config string, names ...string) error {
+	for _, name := range names {
+		items, err := c.search(itemAttributes(config, name))
+		if err != nil {
+			return err
+		}
+
+		if err = c.delete(items); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c KeyringCache) RemoveAll(config string) error {
+	items, err := c.search(map[string]string{applicationAttribute: applicationName, configAttribute: config})
+	if err != nil {
+		return err
+	}
+
+	return c.delete(items)
+}
+
+// SortedAccounts returns the cached accounts of a configuration. Accounts which cannot be read are returned with
+// their error.
+func (c KeyringCache) SortedAccounts(config, prefix string, exclusions []string) ([]Account, error) {
+	items, err := c.search(map[string]string{applicationAttribute: applicationName, configAttribute: config})
+	if err != nil {
+		return nil, err
+	}
+
+	var result []Account
+
+	for _, item := range items {
+		acct, err := c.account(item)
+		if err != nil {
+			acct.Error = err
+		}
+
+		lowerName := strings.ToLower(acct.Object)
+
+		if (prefix == "" || strings.HasPrefix(lowerName, prefix)) &&
+			!ContainsFunc(exclusions, func(s string) bool {
+				return strings.ToLower(s) == lowerName
+			}) {
+			result = append(result, acct)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Object < result[j].Object
+	})
+
+	return result, nil
+}
+
+// Unlock does nothing, the Secret Service unlocking items with the desktop session.
+func (c KeyringCache) Unlock(string, KeySource) error {
+	return nil
+}
+
+func (c KeyringCache) clean(config string, before time.Time) (int, error) {
+	items, err := c.search(map[string]string{applicationAttribute: applicationName, configAttribute: config})
+	if err != nil {
+		return 0, err
+	}
+
+	var expired []dbus.ObjectPath
+
+	for _, item := range items {
+		attributes, err := c.attributes(item)
+		if err != nil {
+			return 0, err
+		}
+
+		if expiresAt, err := strconv.ParseInt(attributes[expiresAtAttribute], 10, 64); err != nil ||
+			expiresAt < before.Unix() {
+			expired = append(expired, item)
+		}
+	}
+
+	return len(expired), c.delete(expired)
+}
+
+func (c KeyringCache) get(config, name string) (Account, error) {
+	items, err := c.search(itemAttributes(config, name))
+	if err != nil {
+		return Account{}, err
+	}
+
+	if len(items) == 0 {
+		return Account{}, NewError(nil, "%s not found in keyring", name)
+	}
+
+	return c.account(items[0])
+}
+
+// hit does nothing, hits being only recorded by SQLite.
+func (c KeyringCache) hit(string, string, time.Time) error {
+	return nil
+}
+
+// merge stores the given accounts, under their own configuration if any or under the default one.
+// Accounts which were read from the keyring are not stored again.
+func (c KeyringCache) merge(defaultConfig string, accounts []Account) error {
+	for _, acct := range accounts {
+		if !acct.ok() {
+			continue
+		}
+
+		config := acct.ref.config
+		if config == "" {
+			config = defaultConfig
+		}
+
+		if cached, err := c.get(config, acct.ref.name); err == nil && !acct.Timestamp.After(cached.Timestamp) {
+			continue
+		}
+
+		if err := c.store(config, acct); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c KeyringCache) store(config string, acct Account) error {
+	data, err := json.Marshal(keyringSecret{Value: acct.Value, Properties: acct.Properties})
+	if err != nil {
+		return err
+	}
+
+	attributes := itemAttributes(config, acct.ref.name)
+
+	// items are replaced only when all their attributes match, the creation date included
+	previous, err := c.search(attributes)
+	if err != nil {
+		return err
+	}
+
+	if err = c.delete(previous); err != nil {
+		return err
+	}
+
+	attributes[createdAtAttribute] = strconv.FormatInt(acct.Timestamp.Unix(), 10)
+	attributes[expiresAtAttribute] = strconv.FormatInt(acct.expiresAt.Unix(), 10)
+
+	body, err := c.bus.call(
+		defaultCollectionPath,
+		collectionInterface+".CreateItem",
+		map[string]dbus.Variant{
+			itemInterface + ".Label":      dbus.MakeVariant(applicationName + " " + config + "/" + acct.ref.name),
+			itemInterface + ".Attributes": dbus.MakeVariant(attributes),
+		},
+		dbusSecret{Session: c.session, Value: data, ContentType: "application/json"},
+		true,
+	)
+	if err != nil {
+		return NewError(err, "failed to store %s in keyring", acct.ref.name)
+	}
+
+	var item, prompt dbus.ObjectPath
+
+	if err = dbus.Store(body, &item, &prompt); err != nil {
+		return err
+	}
+
+	if prompt != noPrompt {
+		return NewError(nil, "keyring is locked")
+	}
+
+	return nil
+}
+
+// search returns the unlocked items having the given attributes.
+func (c KeyringCache) search(attributes map[string]string) ([]dbus.ObjectPath, error) {
+	body, err := c.bus.call(secretServicePath, secretServiceInterface+".SearchItems", attributes)
+	if err != nil {
+		return nil, NewError(err, "failed to search keyring")
+	}
+
+	var unlocked, locked []dbus.ObjectPath
+
+	return unlocked, dbus.Store(body, &unlocked, &locked)
+}
+
+func (c KeyringCache) attributes(item dbus.ObjectPath) (map[string]string, error) {
+	body, err := c.bus.call(item, propertiesGet, itemInterface, "Attributes")
+	if err != nil {
+		return nil, err
+	}
+
+	var result dbus.Variant
+
+	if err = dbus.Store(body, &result); err != nil {
+		return nil, err
+	}
+
+	attributes, ok := result.Value().(map[string]string)
+	if !ok {
+		return nil, NewError(nil, "invalid attributes of %s", item)
+	}
+
+	return attributes, nil
+}
+
+// account returns the account of the item, named after its path if its attributes cannot be read.
+func (c KeyringCache) account(item dbus.ObjectPath) (Account, error) {
+	attributes, err := c.attributes(item)
+	if err != nil {
+		return Account{Object: string(item)}, err
+	}
+
+	name := attributes[nameAttribute]
+
+	body, err := c.bus.call(item, itemInterface+".GetSecret", c.session)
+	if err != nil {
+		return Account{Object: name}, NewError(err, "failed to get secret of %s", name)
+	}
+
+	var (
+		secret  dbusSecret
+		content keyringSecret
+	)
+
+	if err = dbus.Store(body, &secret); err != nil {
+		return Account{Object: name}, NewError(err, "failed to read secret of %s", name)
+	}
+
+	if err = json.Unmarshal(secret.Value, &content); err != nil {
+		return Account{Object: name}, NewError(err, "failed to read secret of %s", name)
+	}
+
+	createdAt, err := strconv.ParseInt(attributes[createdAtAttribute], 10, 64)
+	if err != nil {
+		return Account{Object: name}, NewError(err, "failed to read creation time of %s", name)
+	}
+
+	// items stored by a previous version have no expiry
+	expiresAt, _ := strconv.ParseInt(attributes[expiresAtAttribute], 10, 64)
+
+	return Account{
+		Object:     name,
+		Value:      content.Value,
+		Properties: content.Properties,
+		StatusCode: http.StatusOK,
+		Timestamp:  time.Unix(createdAt, 0),
+		expiresAt:  time.Unix(expiresAt, 0),
+	}, nil
+}
+
+func (c KeyringCache) delete(items []dbus.ObjectPath) error {
+	for _, item := range items {
+		body, err := c.bus.call(item, itemInterface+".Delete")
+		if err != nil {
+			return NewError(err, "failed to delete %s from keyring", item)
+		}
+
+		var prompt dbus.ObjectPath
+
+		if err = dbus.Store(body, &prompt); err != nil {
+			return err
+		}
+
+		if prompt != noPrompt {
+			return NewError(nil, "keyring is locked")
+		}
+	}
+
+	return nil
+}
+
+func itemAttributes(config, name string) map[string]string {
+	return map[string]string{
+		applicationAttribute: applicationName,
+		configAttribute:      config,
+		nameAttribute:        name,
+	}
+}
@@ -0,0 +1,316 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSecretService implements the Secret Service D-Bus methods used by the keyring cache, in process.
+type fakeSecretService struct {
+	closed bool
+	items  map[dbus.ObjectPath]fakeItem
+	locked bool
+	next   int
+	prompt bool // deleting an item asks for a confirmation
+}
+
+type fakeItem struct {
+	attributes map[string]string
+	secret     dbusSecret
+}
+
+func newFakeSecretService() *fakeSecretService {
+	return &fakeSecretService{items: make(map[dbus.ObjectPath]fakeItem)}
+}
+
+// call sends the method call and its reply through the D-Bus wire format,
+// so that the arguments are marshaled as they would be on a real bus.
+func (s *fakeSecretService) call(path dbus.ObjectPath, method string, args ...any) ([]any, error) {
+	dot := strings.LastIndex(method, ".")
+	msg := &dbus.Message{
+		Type: dbus.TypeMethodCall,
+		Headers: map[dbus.HeaderField]dbus.Variant{
+			dbus.FieldDestination: dbus.MakeVariant(secretServiceName),
+			dbus.FieldPath:        dbus.MakeVariant(path),
+			dbus.FieldInterface:   dbus.MakeVariant(method[:dot]),
+			dbus.FieldMember:      dbus.MakeVariant(method[dot+1:]),
+		},
+		Body: args,
+	}
+
+	msg, err := roundTrip(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := s.handle(msg.Headers[dbus.FieldPath].Value().(dbus.ObjectPath), method, msg.Body) //nolint:forcetypeassert
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err = roundTrip(&dbus.Message{
+		Type:    dbus.TypeMethodReply,
+		Headers: map[dbus.HeaderField]dbus.Variant{dbus.FieldReplySerial: dbus.MakeVariant(uint32(1))},
+		Body:    body,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return msg.Body, nil
+}
+
+func roundTrip(msg *dbus.Message) (*dbus.Message, error) {
+	if len(msg.Body) > 0 {
+		msg.Headers[dbus.FieldSignature] = dbus.MakeVariant(dbus.SignatureOf(msg.Body...))
+	}
+
+	var buf bytes.Buffer
+
+	if err := msg.EncodeTo(&buf, binary.LittleEndian); err != nil {
+		return nil, err
+	}
+
+	return dbus.DecodeMessage(&buf)
+}
+
+//nolint:cyclop
+func (s *fakeSecretService) handle(path dbus.ObjectPath, method string, args []any) ([]any, error) {
+	switch method {
+	case secretServiceInterface + ".OpenSession":
+		var (
+			algorithm string
+			input     dbus.Variant
+		)
+
+		if err := dbus.Store(args, &algorithm, &input); err != nil {
+			return nil, err
+		}
+
+		if algorithm != "plain" {
+			return nil, fmt.Errorf("unsupported algorithm %v", algorithm)
+		}
+
+		return []any{dbus.MakeVariant(""), dbus.ObjectPath("/org/freedesktop/secrets/session/1")}, nil
+	case sessionInterface + ".Close":
+		return nil, nil
+	case secretServiceInterface + ".SearchItems":
+		var search map[string]string
+
+		if err := dbus.Store(args, &search); err != nil {
+			return nil, err
+		}
+
+		unlocked, locked := []dbus.ObjectPath{}, []dbus.ObjectPath{}
+
+		for itemPath, item := range s.items {
+			if matches(item.attributes, search) {
+				if s.locked {
+					locked = append(locked, itemPath)
+				} else {
+					unlocked = append(unlocked, itemPath)
+				}
+			}
+		}
+
+		sort.Slice(unlocked, func(i, j int) bool { return unlocked[i] < unlocked[j] })
+
+		return []any{unlocked, locked}, nil
+	case collectionInterface + ".CreateItem":
+		if path != defaultCollectionPath {
+			return nil, fmt.Errorf("no such collection %s", path)
+		}
+
+		if s.locked {
+			return []any{noPrompt, dbus.ObjectPath("/org/freedesktop/secrets/prompt/1")}, nil
+		}
+
+		var (
+			properties map[string]dbus.Variant
+			secret     dbusSecret
+			replace    bool
+		)
+
+		if err := dbus.Store(args, &properties, &secret, &replace); err != nil {
+			return nil, err
+		}
+
+		var attributes map[string]string
+
+		if err := dbus.Store([]any{properties[itemInterface+".Attributes"].Value()}, &attributes); err != nil {
+			return nil, err
+		}
+
+		s.next++
+		itemPath := dbus.ObjectPath(fmt.Sprintf("%s/%d", defaultCollectionPath, s.next))
+		s.items[itemPath] = fakeItem{attributes: attributes, secret: secret}
+
+		return []any{itemPath, noPrompt}, nil
+	case propertiesGet:
+		item, found := s.items[path]
+		if !found {
+			return nil, fmt.Errorf("no such item %s", path)
+		}
+
+		return []any{dbus.MakeVariant(item.attributes)}, nil
+	case itemInterface + ".GetSecret":
+		item, found := s.items[path]
+		if !found {
+			return nil, fmt.Errorf("no such item %s", path)
+		}
+
+		return []any{item.secret}, nil
+	case itemInterface + ".Delete":
+		if s.prompt {
+			return []any{dbus.ObjectPath("/org/freedesktop/secrets/prompt/2")}, nil
+		}
+
+		delete(s.items, path)
+
+		return []any{noPrompt}, nil
+	default:
+		return nil, fmt.Errorf("unknown method %s", method)
+	}
+}
+
+func (s *fakeSecretService) close() error {
+	s.closed = true
+
+	return nil
+}
+
+func matches(attributes, search map[string]string) bool {
+	for key, value := range search {
+		if attributes[key] != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+func newTestKeyringCache(t *testing.T) (KeyringCache, *fakeSecretService) {
+	t.Helper()
+
+	service := newFakeSecretService()
+
+	result, err := newKeyringCache(service)
+	require.NoError(t, err)
+
+	return result, service
+}
+
+func TestKeyringCache(t *testing.T) {
+	cache, service := newTestKeyringCache(t)
+
+	otherAcct := newCachedAccount("other/o1", "other value")
+	failedAcct := *newAccount("o3", now)
+
+	require.NoError(t, cache.merge("test", []Account{
+		newCachedAccount("o2", "value2"),
+		newCachedAccount("o1", "value1"),
+		otherAcct,
+		failedAcct,
+	}))
+	assert.Len(t, service.items, 3)
+
+	acct, err := cache.get("test", "o1")
+	require.NoError(t, err)
+	assert.Equal(t, "value1", acct.Value)
+	assert.Equal(t, map[string]string{"UserName": "user of o1"}, acct.Properties)
+	assert.Equal(t, now, acct.Timestamp.UTC())
+	assert.Equal(t, now.Add(time.Hour), acct.expiresAt.UTC())
+
+	_, err = cache.get("test", "o3")
+	require.Error(t, err)
+
+	configs, err := cache.Configs("")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"other", "test"}, configs)
+
+	accounts, err := cache.SortedAccounts("test", "", []string{"O2"})
+	require.NoError(t, err)
+	require.Len(t, accounts, 1)
+	assert.Equal(t, "o1", accounts[0].Object)
+
+	// a newer account replaces the stored one
+	newer := newCachedAccount("o1", "new value1")
+	newer.Timestamp = now.Add(time.Hour)
+	newer.expiresAt = now.Add(3 * time.Hour)
+
+	require.NoError(t, cache.merge("test", []Account{newer}))
+	assert.Len(t, service.items, 3)
+
+	acct, err = cache.get("test", "o1")
+	require.NoError(t, err)
+	assert.Equal(t, "new value1", acct.Value)
+
+	count, err := cache.clean("test", now.Add(2*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+	assert.Len(t, service.items, 2, "o2 expired, not o1 fetched again")
+
+	require.NoError(t, cache.Remove("test", "o1"))
+	assert.Len(t, service.items, 1)
+
+	require.NoError(t, cache.RemoveAll("test"))
+	assert.Len(t, service.items, 1)
+
+	cache.Close()
+	assert.True(t, service.closed)
+}
+
+func TestKeyringCache_locked(t *testing.T) {
+	cache, service := newTestKeyringCache(t)
+
+	require.NoError(t, cache.merge("test", []Account{newCachedAccount("o1", "value1")}))
+
+	service.locked = true
+
+	_, err := cache.get("test", "o1")
+	require.Error(t, err)
+	require.Error(t, cache.merge("test", []Account{newCachedAccount("o2", "value2")}))
+}
+
+func TestKeyringCache_SortedAccounts_unreadable(t *testing.T) {
+	cache, service := newTestKeyringCache(t)
+
+	require.NoError(t, cache.merge("test", []Account{
+		newCachedAccount("o1", "value1"),
+		newCachedAccount("o2", "value2"),
+	}))
+
+	for path, item := range service.items {
+		if item.attributes[nameAttribute] == "o1" {
+			item.secret.Value = []byte("not JSON")
+			service.items[path] = item
+		}
+	}
+
+	accounts, err := cache.SortedAccounts("test", "", nil)
+	require.NoError(t, err)
+	require.Len(t, accounts, 2)
+	assert.Equal(t, "o1", accounts[0].Object)
+	require.Error(t, accounts[0].Error)
+	assert.Equal(t, "value2", accounts[1].Value)
+}
+
+func TestKeyringCache_Remove_prompt(t *testing.T) {
+	cache, service := newTestKeyringCache(t)
+
+	require.NoError(t, cache.merge("test", []Account{newCachedAccount("o1", "value1")}))
+
+	service.prompt = true
+
+	require.Error(t, cache.Remove("test", "o1"))
+	assert.Len(t, service.items, 1)
+}
@@ -0,0 +1,50 @@
+package internal
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// limiter is a token bucket limiting the rate of the requests of a configuration, a burst of up to one second of
+// requests being allowed.
+type limiter struct {
+	rate   float64
+	burst  float64
+	mutex  sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newLimiter(cfg Config) *limiter {
+	burst := max(math.Floor(cfg.Rate), 1)
+
+	return &limiter{
+		rate:   cfg.Rate,
+		burst:  burst,
+		tokens: burst,
+	}
+}
+
+// reserve takes a token, returning how long to wait for it to be available, or 0 if unlimited.
+func (l *limiter) reserve(now time.Time) time.Duration {
+	if l.rate <= 0 {
+		return 0
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if !l.last.IsZero() && now.After(l.last) {
+		l.tokens = min(l.tokens+now.Sub(l.last).Seconds()*l.rate, l.burst)
+	}
+
+	l.last = now
+	l.tokens--
+
+	if l.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
@@ -0,0 +1,36 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_limiter_reserve(t *testing.T) {
+	l := newLimiter(Config{Rate: 2})
+
+	assert.Equal(t, time.Duration(0), l.reserve(now), "burst")
+	assert.Equal(t, time.Duration(0), l.reserve(now), "burst")
+	assert.Equal(t, 500*time.Millisecond, l.reserve(now))
+	assert.Equal(t, time.Second, l.reserve(now))
+	assert.Equal(t, 500*time.Millisecond, l.reserve(now.Add(time.Second)), "refilled")
+	assert.Equal(t, time.Duration(0), l.reserve(now.Add(time.Hour)), "refilled up to burst")
+	assert.Equal(t, time.Duration(0), l.reserve(now.Add(time.Hour)), "refilled up to burst")
+	assert.Equal(t, 500*time.Millisecond, l.reserve(now.Add(time.Hour)))
+}
+
+func Test_limiter_reserve_unlimited(t *testing.T) {
+	l := newLimiter(Config{})
+
+	for range 10 {
+		assert.Equal(t, time.Duration(0), l.reserve(now))
+	}
+}
+
+func Test_limiter_reserve_slow(t *testing.T) {
+	l := newLimiter(Config{Rate: 0.5})
+
+	assert.Equal(t, time.Duration(0), l.reserve(now))
+	assert.Equal(t, 2*time.Second, l.reserve(now))
+}
@@ -0,0 +1,98 @@
+package internal
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// fileLock is an exclusive lock on a file of the state home, held by a single process at a time,
+// and released by the system if the process exits. The file is removed once unlocked.
+type fileLock struct {
+	file *os.File
+	path string
+}
+
+// lockPoll is the interval between two tries to lock a file held by another process.
+const lockPoll = 20 * time.Millisecond
+
+// lockAccount waits for the lock of an account of a configuration, so that a single process fetches it at a time.
+func lockAccount(ctx context.Context, config, name string) (fileLock, error) {
+	home, err := GetStateHome()
+	if err != nil {
+		return fileLock{}, err
+	}
+
+	dir := filepath.Join(home, "locks")
+
+	if err = os.MkdirAll(dir, rwx); err != nil {
+		return fileLock{}, err
+	}
+
+	sum := sha256.Sum256([]byte(config + "\x00" + name))
+	path := filepath.Join(dir, hex.EncodeToString(sum[:])+".lock")
+
+	for {
+		result, err := lockFile(ctx, path, name)
+		if err != nil {
+			return fileLock{}, err
+		}
+
+		// the file locked may have been removed meanwhile by the process releasing it, another one being locked since
+		if info, err := os.Stat(path); err == nil {
+			if locked, err := result.file.Stat(); err == nil && os.SameFile(info, locked) {
+				return result, nil
+			}
+		}
+
+		_ = unlockFile(result.file)
+		_ = result.file.Close()
+	}
+}
+
+// lockFile waits for the lock of the file, created if needed.
+func lockFile(ctx context.Context, path, name string) (fileLock, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, rw)
+	if err != nil {
+		return fileLock{}, err
+	}
+
+	for {
+		locked, err := tryLockFile(file)
+		if err != nil {
+			_ = file.Close()
+
+			return fileLock{}, NewError(err, "failed to lock %s", name)
+		}
+
+		if locked {
+			return fileLock{file: file, path: path}, nil
+		}
+
+		select {
+		case <-time.After(lockPoll):
+		case <-ctx.Done():
+			_ = file.Close()
+
+			return fileLock{}, ctx.Err()
+		}
+	}
+}
+
+// unlock removes the file, before unlocking it so that it is not removed while locked by another process,
+// or once closed if open files cannot be removed, failing if another process opened it meanwhile.
+func (l fileLock) unlock() {
+	if removeOpenFiles {
+		_ = os.Remove(l.path)
+	}
+
+	_ = unlockFile(l.file)
+	_ = l.file.Close()
+
+	if !removeOpenFiles {
+		_ = os.Remove(l.path)
+	}
+}
@@ -0,0 +1,70 @@
+package internal
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_lockAccount(t *testing.T) {
+	t.Setenv(xdgStateHome, t.TempDir())
+
+	lock, err := lockAccount(context.Background(), "test", "o1")
+	require.NoError(t, err)
+
+	other, err := lockAccount(context.Background(), "test", "o2")
+	require.NoError(t, err, "other account")
+
+	other.unlock()
+
+	locked := make(chan fileLock)
+
+	go func() {
+		l, err := lockAccount(context.Background(), "test", "o1")
+		assert.NoError(t, err)
+
+		locked <- l
+	}()
+
+	select {
+	case <-locked:
+		t.Fatal("locked twice")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	lock.unlock()
+
+	select {
+	case l := <-locked:
+		l.unlock()
+	case <-time.After(time.Second):
+		t.Fatal("not unlocked")
+	}
+
+	home, err := GetStateHome()
+	require.NoError(t, err)
+
+	entries, err := os.ReadDir(filepath.Join(home, "locks"))
+	require.NoError(t, err)
+	assert.Empty(t, entries, "removed once unlocked")
+}
+
+func Test_lockAccount_canceled(t *testing.T) {
+	t.Setenv(xdgStateHome, t.TempDir())
+
+	lock, err := lockAccount(context.Background(), "test", "o1")
+	require.NoError(t, err)
+
+	defer lock.unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err = lockAccount(ctx, "test", "o1")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
@@ -1,10 +1,17 @@
 package internal
 
 import (
+	"encoding/base64"
+	"encoding/csv"
 	"encoding/json"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
+	"unicode/utf16"
 )
 
 const (
@@ -12,15 +19,145 @@ const (
 	rw  = 0o600
 )
 
-func fileOutput(accounts []Account, output string) error {
+const (
+	formatCSV            = "csv"
+	formatDotenv         = "dotenv"
+	formatJavaProperties = "java-properties"
+	formatJSON           = "json"
+	formatJSONL          = "jsonl"
+	formatK8sSecret      = "k8s-secret"
+	formatShell          = "shell"
+	formatTOML           = "toml"
+	formatYAML           = "yaml"
+)
+
+var (
+	secretKeyRegex  = regexp.MustCompile(`[^-._a-zA-Z0-9]`)
+	secretNameRegex = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+)
+
+// Formatter writes the fetched accounts, or the entries built from them, in a given syntax.
+// Entries hold the values to output, failed accounts being left out, while accounts hold their status.
+type Formatter interface {
+	Format(w io.Writer, accounts []Account, entries []Entry) error
+}
+
+// formatterFunc adapts a function to the Formatter interface.
+type formatterFunc func(w io.Writer, accounts []Account, entries []Entry) error
+
+func (f formatterFunc) Format(w io.Writer, accounts []Account, entries []Entry) error {
+	return f(w, accounts, entries)
+}
+
+// formatters registers the supported output formats, built from the parameters of the command.
+//
+//nolint:gochecknoglobals
+var formatters = map[string]func(p Parameters) Formatter{
+	formatCSV:            func(Parameters) Formatter { return formatterFunc(csvOutput) },
+	formatDotenv:         func(Parameters) Formatter { return lineFormatter(dotenvLine) },
+	formatJavaProperties: func(Parameters) Formatter { return lineFormatter(javaPropertiesLine) },
+	formatJSON:           func(Parameters) Formatter { return formatterFunc(jsonOutput) },
+	formatJSONL:          func(Parameters) Formatter { return formatterFunc(jsonlOutput) },
+	formatK8sSecret: func(p Parameters) Formatter {
+		return k8sSecretFormatter{
+			annotations: p.Annotations,
+			labels:      p.Labels,
+			name:        p.SecretName,
+			namespace:   p.Namespace,
+		}
+	},
+	formatShell: func(p Parameters) Formatter {
+		return shellFormatter{
+			export: p.Export,
+			names:  p.Names,
+			shell:  p.shell(),
+		}
+	},
+	formatTOML: func(Parameters) Formatter { return lineFormatter(tomlLine) },
+	formatYAML: func(Parameters) Formatter { return formatterFunc(yamlOutput) },
+}
+
+// Formats returns the supported output formats.
+func Formats() []string {
+	result := make([]string, 0, len(formatters))
+
+	for format := range formatters {
+		result = append(result, format)
+	}
+
+	sort.Strings(result)
+
+	return result
+}
+
+// Entry is a named value to output: an account given as argument or a KEY=VALUE line of a template,
+// followed by the requested properties of its account.
+type Entry struct {
+	Name     string // object of the account, or key of the template line
+	Property string // CCP property, empty for the password
+	Value    string
+}
+
+// Key returns the name of the entry, suffixed by its property if any, e.g. KEY_UserName.
+func (e Entry) Key() string {
+	if e.Property == "" {
+		return e.Name
+	}
+
+	return propertyName(e.Name, e.Property)
+}
+
+func accountEntries(accounts []Account, properties []string) []Entry {
+	var result []Entry
+
+	for _, acct := range accounts {
+		if !acct.ok() {
+			continue
+		}
+
+		result = append(result, Entry{Name: acct.Object, Value: acct.Value})
+		result = append(result, propertyEntries(&acct, acct.Object, properties)...)
+	}
+
+	return result
+}
+
+func templateEntries(tmpl template, accounts map[string]*Account, properties []string) []Entry {
+	var result []Entry
+
+	for _, tl := range tmpl.lines {
+		if tl.key == "" || !tl.resolved(accounts) {
+			continue
+		}
+
+		result = append(result, Entry{Name: tl.key, Value: tl.value(accounts)})
+
+		if acct := tl.account(accounts); acct.ok() {
+			result = append(result, propertyEntries(acct, tl.key, properties)...)
+		}
+	}
+
+	return result
+}
+
+func propertyEntries(acct *Account, name string, properties []string) []Entry {
+	result := make([]Entry, len(properties))
+
+	for i, property := range properties {
+		result[i] = Entry{Name: name, Property: property, Value: acct.property(property)}
+	}
+
+	return result
+}
+
+func fileOutput(entries []Entry, output string) error {
 	err := os.MkdirAll(output, rwx)
 	if err != nil {
 		return err
 	}
 
-	for _, acct := range accounts {
-		err := os.WriteFile(filepath.Join(output, acct.key), []byte(acct.Value), rw)
-		if err != nil {
+	for _, e := range entries {
+		if err = os.WriteFile(filepath.Join(output, e.Key()), []byte(e.Value), rw); err != nil {
 			return err
 		}
 	}
@@ -28,27 +165,203 @@ func fileOutput(accounts []Account, output string) error {
 	return nil
 }
 
-func jsonOutput(accounts []Account) (string, error) {
-	bytes, err := json.MarshalIndent(accounts, "", "  ")
-	if err != nil {
-		return "", err
+// lineFormatter writes one line per entry.
+type lineFormatter func(e Entry) string
+
+func (f lineFormatter) Format(w io.Writer, _ []Account, entries []Entry) error {
+	for _, e := range entries {
+		if _, err := io.WriteString(w, f(e)+"\n"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func csvOutput(w io.Writer, _ []Account, entries []Entry) error {
+	writer := csv.NewWriter(w)
+
+	if err := writer.Write([]string{"name", "value"}); err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if err := writer.Write([]string{e.Key(), e.Value}); err != nil {
+			return err
+		}
 	}
 
-	return string(bytes), nil
+	writer.Flush()
+
+	return writer.Error()
+}
+
+// dotenvLine returns a double-quoted value, escaping what dotenv loaders would interpret.
+func dotenvLine(e Entry) string {
+	return e.Key() + `="` + strings.NewReplacer(
+		`\`, `\\`,
+		`"`, `\"`,
+		`$`, `\$`,
+		"`", "\\`",
+		"\n", `\n`,
+		"\r", `\r`,
+	).Replace(e.Value) + `"`
 }
 
-func shellOutput(accounts []Account, fromStdin bool) string {
+// javaPropertiesLine escapes the value as java.util.Properties#load expects, non ASCII characters included.
+func javaPropertiesLine(e Entry) string {
+	return javaPropertiesEscape(e.Key(), true) + "=" + javaPropertiesEscape(e.Value, false)
+}
+
+func javaPropertiesEscape(s string, key bool) string {
 	sb := strings.Builder{}
 
-	for i, acct := range accounts {
-		if acct.ok() {
-			if i > 0 {
-				sb.WriteRune('\n')
+	for i, r := range s {
+		switch {
+		case r == '\\':
+			sb.WriteString(`\\`)
+		case r == '\n':
+			sb.WriteString(`\n`)
+		case r == '\r':
+			sb.WriteString(`\r`)
+		case r == '\t':
+			sb.WriteString(`\t`)
+		case r == '\f':
+			sb.WriteString(`\f`)
+		case r == ' ' && (key || i == 0):
+			sb.WriteString(`\ `)
+		case key && strings.ContainsRune("=:#!", r):
+			sb.WriteRune('\\')
+			sb.WriteRune(r)
+		case r < ' ' || r > '~':
+			for _, u := range utf16.Encode([]rune{r}) {
+				fmt.Fprintf(&sb, `\u%04x`, u)
 			}
-
-			sb.WriteString(acct.shell(fromStdin))
+		default:
+			sb.WriteRune(r)
 		}
 	}
 
 	return sb.String()
 }
+
+func jsonOutput(w io.Writer, accounts []Account, _ []Entry) error {
+	return writeJSON(w, accounts)
+}
+
+func writeJSON(w io.Writer, v any) error {
+	bytes, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(append(bytes, '\n'))
+
+	return err
+}
+
+func jsonlOutput(w io.Writer, accounts []Account, _ []Entry) error {
+	encoder := json.NewEncoder(w)
+
+	for _, acct := range accounts {
+		if err := encoder.Encode(acct); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func tomlLine(e Entry) string {
+	return quote(e.Key()) + " = " + quote(e.Value)
+}
+
+func yamlOutput(w io.Writer, _ []Account, entries []Entry) error {
+	if len(entries) == 0 {
+		_, err := io.WriteString(w, "{}\n")
+
+		return err
+	}
+
+	for _, e := range entries {
+		if _, err := io.WriteString(w, quote(e.Key())+": "+quote(e.Value)+"\n"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// k8sSecretFormatter writes a Kubernetes v1/Secret manifest holding the entries.
+type k8sSecretFormatter struct {
+	annotations, labels map[string]string
+	name, namespace     string
+}
+
+func (f k8sSecretFormatter) Format(w io.Writer, _ []Account, entries []Entry) error {
+	sb := strings.Builder{}
+
+	sb.WriteString("apiVersion: v1\n")
+	sb.WriteString("kind: Secret\n")
+	sb.WriteString("metadata:\n")
+	sb.WriteString("  name: " + quote(f.name) + "\n")
+
+	if f.namespace != "" {
+		sb.WriteString("  namespace: " + quote(f.namespace) + "\n")
+	}
+
+	writeYAMLMap(&sb, "labels", f.labels)
+	writeYAMLMap(&sb, "annotations", f.annotations)
+
+	sb.WriteString("type: Opaque\n")
+
+	if len(entries) == 0 {
+		sb.WriteString("data: {}\n")
+	} else {
+		sb.WriteString("data:\n")
+	}
+
+	for _, e := range entries {
+		sb.WriteString("  " + quote(secretKey(e.Key())) + ": " + base64.StdEncoding.EncodeToString([]byte(e.Value)) + "\n")
+	}
+
+	_, err := io.WriteString(w, sb.String())
+
+	return err
+}
+
+func writeYAMLMap(sb *strings.Builder, name string, m map[string]string) {
+	if len(m) == 0 {
+		return
+	}
+
+	keys := make([]string, 0, len(m))
+
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	sb.WriteString("  " + name + ":\n")
+
+	for _, key := range keys {
+		sb.WriteString("    " + quote(key) + ": " + quote(m[key]) + "\n")
+	}
+}
+
+// quote returns a JSON string, which is also a valid double-quoted YAML scalar and TOML basic string.
+func quote(s string) string {
+	sb := strings.Builder{}
+	encoder := json.NewEncoder(&sb)
+
+	encoder.SetEscapeHTML(false)
+	_ = encoder.Encode(s)
+
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// secretKey replaces the characters not allowed in a Secret data key.
+func secretKey(name string) string {
+	return secretKeyRegex.ReplaceAllString(name, "_")
+}
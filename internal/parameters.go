@@ -3,8 +3,10 @@ package internal
 import (
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/spf13/pflag"
 )
@@ -12,10 +14,31 @@ import (
 type Parameters struct {
 	Config
 
-	CfgName string
-	JSON    bool
-	Objects []string
-	Output  string
+	Annotations     map[string]string
+	CacheKey        KeySource
+	CfgName         string
+	Deadline        time.Duration
+	Env             []string
+	EnvFile         string
+	Export          bool
+	FallbackToCache bool
+	Format          string
+	HTTPClient      func(cfg Config) (*http.Client, error)
+	JSON            bool
+	Labels          map[string]string
+	LoadConfig      func(name string) (Config, error)
+	Names           map[string]string
+	Namespace       string
+	NoCache         bool
+	Objects         []string
+	Offline         bool
+	Output          string
+	Properties      []string
+	Refresh         bool
+	SecretName      string
+	Shell           string
+	Stats           bool
+	Template        string
 
 	log *log.Logger
 }
@@ -26,6 +49,13 @@ func NewParameters() Parameters {
 	}
 }
 
+// WithLog returns the parameters logging errors with the given logger.
+func (p Parameters) WithLog(l *log.Logger) Parameters {
+	p.log = l
+
+	return p
+}
+
 func (p Parameters) Errorf(format string, v ...any) {
 	p.log.Printf(format, v...)
 }
@@ -47,7 +77,7 @@ func (p Parameters) Validate() error {
 		errors = append(errors, "Key file is mandatory")
 	}
 
-	if p.Host == "" {
+	if p.Host == "" && len(p.Hosts) == 0 {
 		errors = append(errors, "Host is mandatory")
 	}
 
@@ -59,7 +89,12 @@ func (p Parameters) Validate() error {
 		errors = append(errors, "Safe is mandatory")
 	}
 
-	if len(p.Objects) == 0 {
+	switch {
+	case p.fromEnv() || p.Template != "":
+		if p.MaxConns <= 0 {
+			errors = append(errors, fmt.Sprintf("Max connections must be > 0: %v", p.MaxConns))
+		}
+	case len(p.Objects) == 0:
 		errors = p.validateObject(errors)
 	}
 
@@ -67,10 +102,56 @@ func (p Parameters) Validate() error {
 		errors = append(errors, fmt.Sprintf("Max connections must be >= 0: %v", p.MaxConns))
 	}
 
+	if p.Deadline < 0 {
+		errors = append(errors, fmt.Sprintf("Deadline must be >= 0: %v", p.Deadline))
+	}
+
+	if p.MaxStale < 0 {
+		errors = append(errors, fmt.Sprintf("Max stale must be >= 0: %v", p.MaxStale))
+	}
+
+	if p.BreakerThreshold < 0 {
+		errors = append(errors, fmt.Sprintf("Breaker threshold must be >= 0: %v", p.BreakerThreshold))
+	}
+
+	if p.Rate < 0 {
+		errors = append(errors, fmt.Sprintf("Rate must be >= 0: %v", p.Rate))
+	}
+
+	if p.Jitter < 0 || p.Jitter > 1 {
+		errors = append(errors, fmt.Sprintf("Jitter must be between 0 and 1: %v", p.Jitter))
+	}
+
+	if p.MaxWait < 0 {
+		errors = append(errors, fmt.Sprintf("Max wait must be >= 0: %v", p.MaxWait))
+	}
+
 	if p.MaxTries <= 0 {
 		errors = append(errors, fmt.Sprintf("Max tries must be > 0: %v", p.MaxTries))
 	}
 
+	if !p.validQueryFormat() {
+		errors = append(errors, fmt.Sprintf(
+			"Query format must be %s or %s: %v", queryFormatExact, queryFormatRegexp, p.QueryFormat,
+		))
+	}
+
+	if !Contains(CacheBackends(), p.cacheBackend()) {
+		errors = append(errors, fmt.Sprintf(
+			"Cache backend must be one of %s: %v", strings.Join(CacheBackends(), ", "), p.CacheBackend,
+		))
+	}
+
+	if p.Offline && (p.NoCache || p.Refresh) {
+		errors = append(errors, "Offline cannot be used with no cache or refresh")
+	}
+
+	errors = p.validateFormat(errors)
+
+	if len(p.Properties) > 0 && p.fromStdin() && p.Output == "" && p.format() == formatShell {
+		errors = append(errors, "Properties are not supported with a template, use ${CYBERARK:OBJECT#PROPERTY} instead")
+	}
+
 	if p.Output != "" && !p.fromStdin() {
 		errors = append(errors, "no args should be given if output is set")
 	}
@@ -101,6 +182,60 @@ func (p Parameters) validateObject(errors []string) []string {
 	return errors
 }
 
+func (p Parameters) validateFormat(errors []string) []string {
+	if _, found := formatters[p.format()]; !found {
+		errors = append(errors, fmt.Sprintf(
+			"Format must be one of %s: %v", strings.Join(Formats(), ", "), p.Format,
+		))
+	}
+
+	if p.format() == formatK8sSecret && !secretNameRegex.MatchString(p.SecretName) {
+		errors = append(errors, fmt.Sprintf("Secret name must be a valid DNS subdomain name: %q", p.SecretName))
+	}
+
+	if !Contains(Shells(), p.shell()) {
+		errors = append(errors, fmt.Sprintf("Shell must be one of %s: %v", strings.Join(Shells(), ", "), p.Shell))
+	}
+
+	for object, name := range p.Names {
+		if !identifierRegex.MatchString(name) {
+			errors = append(errors, fmt.Sprintf("Invalid variable name for %s: %q", object, name))
+		}
+	}
+
+	if p.Output != "" && p.format() != formatShell {
+		errors = append(errors, "Output path can only be used with shell format")
+	}
+
+	return errors
+}
+
+// format returns the output format, --json being a shortcut for --format json.
+func (p Parameters) format() string {
+	if p.JSON {
+		return formatJSON
+	}
+
+	if p.Format == "" {
+		return formatShell
+	}
+
+	return p.Format
+}
+
+// shell returns the shell dialect of the shell format, POSIX by default.
+func (p Parameters) shell() string {
+	if p.Shell == "" {
+		return shellPosix
+	}
+
+	return p.Shell
+}
+
+func (p Parameters) fromEnv() bool {
+	return len(p.Env) > 0 || p.EnvFile != ""
+}
+
 func (p Parameters) fromStdin() bool {
-	return len(p.Objects) == 0
+	return len(p.Objects) == 0 && !p.fromEnv() && p.Template == ""
 }
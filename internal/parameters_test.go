@@ -162,6 +162,127 @@ func TestParameters_Valid(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "queryFormat",
+			params: Parameters{
+				log: log.New(os.Stderr, "", 0),
+				Config: Config{
+					Criteria: Criteria{QueryFormat: "Fuzzy"},
+					CertFile: "certFile",
+					KeyFile:  "keyFile",
+					Host:     "host",
+					AppID:    "appId",
+					Safe:     "safe",
+					MaxTries: 1,
+				},
+				Objects: []string{"object1"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "format",
+			params: Parameters{
+				log: log.New(os.Stderr, "", 0),
+				Config: Config{
+					CertFile: "certFile",
+					KeyFile:  "keyFile",
+					Host:     "host",
+					AppID:    "appId",
+					Safe:     "safe",
+					MaxTries: 1,
+				},
+				Format:  "unknown",
+				Objects: []string{"object1"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "k8s-secret",
+			params: Parameters{
+				log: log.New(os.Stderr, "", 0),
+				Config: Config{
+					CertFile: "certFile",
+					KeyFile:  "keyFile",
+					Host:     "host",
+					AppID:    "appId",
+					Safe:     "safe",
+					MaxTries: 1,
+				},
+				Format:     "k8s-secret",
+				Objects:    []string{"object1"},
+				SecretName: "my-secret",
+			},
+		},
+		{
+			name: "k8s-secret name",
+			params: Parameters{
+				log: log.New(os.Stderr, "", 0),
+				Config: Config{
+					CertFile: "certFile",
+					KeyFile:  "keyFile",
+					Host:     "host",
+					AppID:    "appId",
+					Safe:     "safe",
+					MaxTries: 1,
+				},
+				Format:     "k8s-secret",
+				Objects:    []string{"object1"},
+				SecretName: "My_Secret",
+			},
+			wantErr: true,
+		},
+		{
+			name: "shell",
+			params: Parameters{
+				log: log.New(os.Stderr, "", 0),
+				Config: Config{
+					CertFile: "certFile",
+					KeyFile:  "keyFile",
+					Host:     "host",
+					AppID:    "appId",
+					Safe:     "safe",
+					MaxTries: 1,
+				},
+				Objects: []string{"object1"},
+				Shell:   "zsh",
+			},
+			wantErr: true,
+		},
+		{
+			name: "offline refresh",
+			params: Parameters{
+				log: log.New(os.Stderr, "", 0),
+				Config: Config{
+					CertFile: "certFile",
+					KeyFile:  "keyFile",
+					Host:     "host",
+					AppID:    "appId",
+					Safe:     "safe",
+					MaxTries: 1,
+				},
+				Objects: []string{"object1"},
+				Offline: true,
+				Refresh: true,
+			},
+			wantErr: true,
+		},
+		{
+			name: "var",
+			params: Parameters{
+				log: log.New(os.Stderr, "", 0),
+				Config: Config{
+					CertFile: "certFile",
+					KeyFile:  "keyFile",
+					Host:     "host",
+					AppID:    "appId",
+					Safe:     "safe",
+					MaxTries: 1,
+				},
+				Names:   map[string]string{"object1": "MY-VAR"},
+				Objects: []string{"object1"},
+			},
+			wantErr: true,
+		},
 		{
 			name: "maxTries",
 			params: Parameters{
@@ -0,0 +1,107 @@
+package internal
+
+import (
+	"strings"
+)
+
+const (
+	defaultOption = "default"
+
+	// placeholderEscape precedes a }, # or | to be taken literally in a placeholder, e.g. |default=a\}b.
+	placeholderEscape = '\\'
+	escapedChars      = "}#|"
+)
+
+var placeholderUnescaper = strings.NewReplacer(`\}`, "}", `\#`, "#", `\|`, "|")
+
+// placeholder is a ${CYBERARK:...} occurrence read from stdin, whose body follows the grammar
+// REFERENCE[#PROPERTY][|default=VALUE], e.g. ${CYBERARK:OBJECT#UserName|default=admin}.
+type placeholder struct {
+	property string
+	fallback *string
+}
+
+// parsePlaceholder splits a placeholder body into its account reference and the placeholder itself.
+func parsePlaceholder(body string) (string, placeholder, error) {
+	var result placeholder
+
+	parts := splitUnescaped(body, '|')
+	ref := parts[0]
+
+	for _, option := range parts[1:] {
+		name, value, _ := strings.Cut(option, "=")
+
+		if name != defaultOption {
+			return ref, result, NewError(nil, "unknown option %q in placeholder %q", name, body)
+		}
+
+		value = placeholderUnescaper.Replace(value)
+		result.fallback = &value
+	}
+
+	if i := lastIndexUnescaped(ref, '#'); i >= 0 {
+		result.property = placeholderUnescaper.Replace(ref[i+1:])
+		ref = ref[:i]
+	}
+
+	return placeholderUnescaper.Replace(ref), result, nil
+}
+
+// indexUnescaped returns the index of the first c of s not escaped, or -1.
+func indexUnescaped(s string, c byte) int {
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == placeholderEscape && i+1 < len(s) && strings.IndexByte(escapedChars, s[i+1]) >= 0:
+			i++
+		case s[i] == c:
+			return i
+		}
+	}
+
+	return -1
+}
+
+// lastIndexUnescaped returns the index of the last c of s not escaped, or -1.
+func lastIndexUnescaped(s string, c byte) int {
+	result := -1
+
+	for i := indexUnescaped(s, c); i >= 0; {
+		result = i
+
+		next := indexUnescaped(s[i+1:], c)
+		if next < 0 {
+			break
+		}
+
+		i += next + 1
+	}
+
+	return result
+}
+
+// splitUnescaped splits s around each c not escaped, keeping the escapes.
+func splitUnescaped(s string, c byte) []string {
+	var result []string
+
+	for i := indexUnescaped(s, c); i >= 0; i = indexUnescaped(s, c) {
+		result = append(result, s[:i])
+		s = s[i+1:]
+	}
+
+	return append(result, s)
+}
+
+// value returns the value to substitute to the placeholder and whether it could be resolved.
+func (p placeholder) value(acct *Account) (string, bool) {
+	if acct.ok() {
+		if value, found := acct.lookup(p.property); found {
+			return value, true
+		}
+	}
+
+	if p.fallback != nil {
+		return *p.fallback, true
+	}
+
+	return "", false
+}
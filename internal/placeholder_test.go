@@ -0,0 +1,161 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func ptr(s string) *string {
+	return &s
+}
+
+func Test_parsePlaceholder(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		wantRef string
+		want    placeholder
+		wantErr bool
+	}{
+		{
+			name:    "object",
+			body:    "OBJECT",
+			wantRef: "OBJECT",
+			want:    placeholder{},
+		},
+		{
+			name:    "property",
+			body:    "OBJECT#UserName",
+			wantRef: "OBJECT",
+			want:    placeholder{property: "UserName"},
+		},
+		{
+			name:    "default",
+			body:    "OBJECT|default=foo",
+			wantRef: "OBJECT",
+			want:    placeholder{fallback: ptr("foo")},
+		},
+		{
+			name:    "empty default",
+			body:    "OBJECT|default=",
+			wantRef: "OBJECT",
+			want:    placeholder{fallback: ptr("")},
+		},
+		{
+			name:    "criteria, property and default",
+			body:    "OBJECT?UserName=admin#Address|default=localhost",
+			wantRef: "OBJECT?UserName=admin",
+			want:    placeholder{property: "Address", fallback: ptr("localhost")},
+		},
+		{
+			name:    "escaped",
+			body:    `OBJECT?Query=a\#b\|c#User\#Name|default={x\}`,
+			wantRef: "OBJECT?Query=a#b|c",
+			want:    placeholder{property: "User#Name", fallback: ptr("{x}")},
+		},
+		{
+			name:    "escaped criteria only",
+			body:    `OBJECT?Query=a\#b`,
+			wantRef: "OBJECT?Query=a#b",
+			want:    placeholder{},
+		},
+		{
+			name:    "backslash kept",
+			body:    `OBJECT?Folder=Root\OS|default=a\b`,
+			wantRef: `OBJECT?Folder=Root\OS`,
+			want:    placeholder{fallback: ptr(`a\b`)},
+		},
+		{
+			name:    "unknown option",
+			body:    "OBJECT|unknown=foo",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ref, got, err := parsePlaceholder(tt.body)
+
+			if tt.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tt.wantRef, ref)
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func Test_placeholder_value(t *testing.T) {
+	ok := &Account{
+		Value:      "value",
+		Properties: map[string]string{"UserName": "user"},
+		StatusCode: 200,
+	}
+	ko := &Account{
+		StatusCode: 404,
+	}
+
+	tests := []struct {
+		name   string
+		p      placeholder
+		acct   *Account
+		want   string
+		wantOk bool
+	}{
+		{
+			name:   "value",
+			p:      placeholder{},
+			acct:   ok,
+			want:   "value",
+			wantOk: true,
+		},
+		{
+			name:   "property",
+			p:      placeholder{property: "UserName"},
+			acct:   ok,
+			want:   "user",
+			wantOk: true,
+		},
+		{
+			name:   "missing property",
+			p:      placeholder{property: "Address"},
+			acct:   ok,
+			want:   "",
+			wantOk: false,
+		},
+		{
+			name:   "missing property with default",
+			p:      placeholder{property: "Address", fallback: ptr("localhost")},
+			acct:   ok,
+			want:   "localhost",
+			wantOk: true,
+		},
+		{
+			name:   "error",
+			p:      placeholder{},
+			acct:   ko,
+			want:   "",
+			wantOk: false,
+		},
+		{
+			name:   "error with default",
+			p:      placeholder{fallback: ptr("default")},
+			acct:   ko,
+			want:   "default",
+			wantOk: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, gotOk := tt.p.value(tt.acct)
+
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantOk, gotOk)
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package internal
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	texttemplate "text/template"
+	"time"
+)
+
+// renderer backs the lookup functions of a Go template. Accounts are collected by executing the template
+// until no new one is referenced, then fetched all at once, the last execution giving the output.
+type renderer struct {
+	accounts map[string]*Account
+	missing  []*Account
+	now      time.Time
+	strict   bool
+}
+
+// Render executes the Go template given by --template once every account it references has been resolved.
+func (c Client) Render(ctx context.Context) error {
+	data, err := os.ReadFile(c.params.Template)
+	if err != nil {
+		return err
+	}
+
+	r := &renderer{
+		accounts: make(map[string]*Account),
+		now:      c.clock.now(),
+	}
+
+	tmpl, err := texttemplate.New(filepath.Base(c.params.Template)).
+		Option("missingkey=error").
+		Funcs(r.funcs()).
+		Parse(string(data))
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := c.withDeadline(ctx)
+	defer cancel()
+
+	accounts, err := r.collect(ctx, c, tmpl)
+	if err != nil {
+		return err
+	}
+
+	if err = c.ok(accounts); err != nil {
+		return err
+	}
+
+	r.strict = true
+
+	defer c.wait()
+
+	return tmpl.Execute(c.log.Writer(), nil)
+}
+
+func (r *renderer) collect(ctx context.Context, c Client, tmpl *texttemplate.Template) ([]Account, error) {
+	var result []Account
+
+	for {
+		r.missing = nil
+
+		_ = tmpl.Execute(io.Discard, nil)
+
+		if len(r.missing) == 0 {
+			return result, nil
+		}
+
+		accounts, err := c.fetch(ctx, r.missing)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range accounts {
+			r.accounts[accounts[i].Object] = &accounts[i]
+		}
+
+		result = append(result, accounts...)
+	}
+}
+
+func (r *renderer) funcs() texttemplate.FuncMap {
+	return texttemplate.FuncMap{
+		"b64enc": func(s string) string {
+			return base64.StdEncoding.EncodeToString([]byte(s))
+		},
+		"cyberark": func(ref string) (string, error) {
+			return r.lookup(ref, "")
+		},
+		"cyberarkField": r.lookup,
+		"json": func(v any) (string, error) {
+			data, err := json.Marshal(v)
+
+			return string(data), err
+		},
+		"quote": strconv.Quote,
+	}
+}
+
+// lookup returns the given property of the referenced account, recording the account if not known yet.
+func (r *renderer) lookup(ref, property string) (string, error) {
+	acct, found := r.accounts[ref]
+	if !found {
+		acct = newPlaceholderAccount(ref, r.now)
+		r.accounts[ref] = acct
+		r.missing = append(r.missing, acct)
+	}
+
+	if !acct.ok() {
+		if r.strict {
+			return "", NewError(acct.Error, "failed to get %s", ref)
+		}
+
+		return "", nil
+	}
+
+	return acct.property(property), nil
+}
@@ -0,0 +1,79 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRenderClient(t *testing.T, text string) (Client, *atomic.Int32) {
+	t.Helper()
+
+	calls := &atomic.Int32{}
+	client := newTestClient(
+		t,
+		func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+
+			object := r.URL.Query().Get("Object")
+
+			if object == "unknown" {
+				w.WriteHeader(http.StatusNotFound)
+			} else {
+				_, _ = fmt.Fprintf(w, "{\"Content\": \"value for %s\", \"UserName\": \"%s\"}\n", object, object+"_user")
+			}
+		},
+	)
+	client.params.MaxConns = 2
+	client.params.Objects = nil
+	client.params.Template = filepath.Join(t.TempDir(), "test.tmpl")
+
+	require.NoError(t, os.WriteFile(client.params.Template, []byte(text), rw))
+
+	return client, calls
+}
+
+func TestClient_Render(t *testing.T) {
+	client, calls := newTestRenderClient(
+		t,
+		`<user>{{ cyberarkField "o1" "UserName" }}</user>
+<password>{{ cyberark "o1" }}</password>
+{{ if eq (cyberarkField "o2" "UserName") "o2_user" }}<secret>{{ cyberark "o3" | b64enc }}</secret>{{ end }}
+{{ cyberark "o1" | quote }} {{ cyberarkField "o2" "UserName" | json }}
+`,
+	)
+	buf := captureOutput(client)
+
+	require.NoError(t, client.Render(context.Background()))
+	assert.Equal(
+		t,
+		`<user>o1_user</user>
+<password>value for o1</password>
+<secret>dmFsdWUgZm9yIG8z</secret>
+"value for o1" "o2_user"
+`,
+		buf.String(),
+	)
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+func TestClient_Render_Error(t *testing.T) {
+	client, _ := newTestRenderClient(t, `{{ cyberark "o1" }} {{ cyberark "unknown" }}`)
+	buf := captureOutput(client)
+
+	require.Error(t, client.Render(context.Background()))
+	assert.Empty(t, buf.String())
+}
+
+func TestClient_Render_InvalidTemplate(t *testing.T) {
+	client, _ := newTestRenderClient(t, `{{ cyberark "o1" `)
+
+	require.Error(t, client.Render(context.Background()))
+}
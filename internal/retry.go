@@ -0,0 +1,105 @@
+package internal
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const defaultMaxWait = 30 * time.Second
+
+// retryPolicy tells which failed accounts are tried again, and how long to wait before.
+type retryPolicy struct {
+	maxTries   int
+	statuses   []int
+	errorCodes []string
+	wait       time.Duration
+	maxWait    time.Duration
+	jitter     float64
+	random     func() float64
+}
+
+// defaultRetryStatuses are the HTTP statuses retried unless configured otherwise.
+func defaultRetryStatuses() []int {
+	return []int{
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout,
+	}
+}
+
+// retry tells whether the account can be tried again: CyberArk could not be reached, or answered a retryable
+// status or error code.
+func (p retryPolicy) retry(acct *Account) bool {
+	if acct.Try >= p.maxTries {
+		return false
+	}
+
+	return acct.StatusCode == 0 ||
+		Contains(p.statuses, acct.StatusCode) ||
+		(acct.errorCode != "" && Contains(p.errorCodes, acct.errorCode))
+}
+
+// delay returns how long to wait before the next try of the account: the Retry-After of the server if any,
+// otherwise an exponential backoff from wait, with jitter. It never exceeds maxWait.
+func (p retryPolicy) delay(acct *Account) time.Duration {
+	if acct.retryAfter > 0 {
+		return min(acct.retryAfter, p.maxWait)
+	}
+
+	result := p.maxWait
+
+	// 1 << 30 times any wait exceeds any sensible maxWait
+	if shift := acct.Try - 1; shift < 30 {
+		result = min(p.wait<<shift, p.maxWait)
+	}
+
+	if p.jitter > 0 {
+		result -= time.Duration(p.jitter * p.random() * float64(result))
+	}
+
+	return result
+}
+
+// parseRetryAfter returns the delay given by a Retry-After header, either in seconds or as an HTTP date,
+// or 0 if missing or invalid.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+
+	if t, err := http.ParseTime(value); err == nil {
+		return max(t.Sub(now), 0)
+	}
+
+	return 0
+}
+
+// retryPolicy returns the retry policy of the configuration.
+func (c Config) retryPolicy() retryPolicy {
+	result := retryPolicy{
+		maxTries:   c.MaxTries,
+		statuses:   c.RetryStatuses,
+		errorCodes: c.RetryErrorCodes,
+		wait:       c.Wait,
+		maxWait:    c.MaxWait,
+		jitter:     c.Jitter,
+		random:     rand.Float64,
+	}
+
+	if len(result.statuses) == 0 {
+		result.statuses = defaultRetryStatuses()
+	}
+
+	if result.maxWait == 0 {
+		result.maxWait = defaultMaxWait
+	}
+
+	return result
+}
@@ -0,0 +1,145 @@
+package internal
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_retryPolicy_retry(t *testing.T) {
+	tests := []struct {
+		name string
+		acct *Account
+		want bool
+	}{
+		{
+			name: "200",
+			acct: &Account{
+				StatusCode: 200,
+				Try:        1,
+			},
+			want: false,
+		},
+		{
+			name: "500",
+			acct: &Account{
+				StatusCode: 500,
+				Try:        1,
+			},
+			want: true,
+		},
+		{
+			name: "502",
+			acct: &Account{
+				StatusCode: 502,
+				Try:        2,
+			},
+			want: true,
+		},
+		{
+			name: "503",
+			acct: &Account{
+				StatusCode: 503,
+				Try:        3,
+			},
+			want: true,
+		},
+		{
+			name: "504",
+			acct: &Account{
+				StatusCode: 504,
+				Try:        4,
+			},
+			want: true,
+		},
+		{
+			name: "504",
+			acct: &Account{
+				StatusCode: 504,
+				Try:        5,
+			},
+			want: false,
+		},
+		{
+			name: "connection failure",
+			acct: &Account{
+				Try: 1,
+			},
+			want: true,
+		},
+		{
+			name: "404",
+			acct: &Account{
+				StatusCode: 404,
+				Try:        1,
+			},
+			want: false,
+		},
+		{
+			name: "error code",
+			acct: &Account{
+				StatusCode: 404,
+				Try:        1,
+				errorCode:  "APPAP004E",
+			},
+			want: true,
+		},
+		{
+			name: "other error code",
+			acct: &Account{
+				StatusCode: 404,
+				Try:        1,
+				errorCode:  "APPAP227E",
+			},
+			want: false,
+		},
+	}
+
+	policy := Config{MaxTries: 5, RetryErrorCodes: []string{"APPAP004E"}}.retryPolicy()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, policy.retry(tt.acct))
+		})
+	}
+}
+
+func Test_retryPolicy_retry_statuses(t *testing.T) {
+	policy := Config{MaxTries: 5, RetryStatuses: []int{http.StatusTooManyRequests}}.retryPolicy()
+
+	assert.True(t, policy.retry(&Account{StatusCode: http.StatusTooManyRequests, Try: 1}))
+	assert.False(t, policy.retry(&Account{StatusCode: http.StatusServiceUnavailable, Try: 1}))
+	assert.True(t, policy.retry(&Account{Try: 1}), "connection failure")
+}
+
+func Test_retryPolicy_delay(t *testing.T) {
+	policy := Config{MaxTries: 100, Wait: 100 * time.Millisecond, MaxWait: time.Second}.retryPolicy()
+
+	assert.Equal(t, 100*time.Millisecond, policy.delay(&Account{Try: 1}))
+	assert.Equal(t, 200*time.Millisecond, policy.delay(&Account{Try: 2}))
+	assert.Equal(t, 800*time.Millisecond, policy.delay(&Account{Try: 4}))
+	assert.Equal(t, time.Second, policy.delay(&Account{Try: 5}), "max wait")
+	assert.Equal(t, time.Second, policy.delay(&Account{Try: 99}), "overflow")
+	assert.Equal(t, 500*time.Millisecond, policy.delay(&Account{Try: 1, retryAfter: 500 * time.Millisecond}))
+	assert.Equal(t, time.Second, policy.delay(&Account{Try: 1, retryAfter: time.Hour}), "Retry-After over max wait")
+
+	policy.jitter = 0.5
+	policy.random = func() float64 { return 0.5 }
+
+	assert.Equal(t, 600*time.Millisecond, policy.delay(&Account{Try: 4}))
+
+	policy.random = func() float64 { return 0 }
+
+	assert.Equal(t, 800*time.Millisecond, policy.delay(&Account{Try: 4}))
+}
+
+func Test_parseRetryAfter(t *testing.T) {
+	assert.Equal(t, time.Duration(0), parseRetryAfter("", now))
+	assert.Equal(t, 7*time.Second, parseRetryAfter("7", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("-7", now))
+	assert.Equal(t, time.Minute, parseRetryAfter(now.Add(time.Minute).Format(http.TimeFormat), now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter(now.Add(-time.Minute).Format(http.TimeFormat), now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("soon", now))
+}
@@ -0,0 +1,157 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+const (
+	shellBash       = "bash"
+	shellFish       = "fish"
+	shellPosix      = "posix"
+	shellPowerShell = "powershell"
+)
+
+var (
+	identifierRegex        = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+	invalidIdentifierRegex = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+)
+
+// Shells returns the supported shell dialects.
+func Shells() []string {
+	return []string{shellBash, shellFish, shellPosix, shellPowerShell}
+}
+
+// shellFormatter writes variable assignments that can be safely evaluated by the given shell.
+type shellFormatter struct {
+	export bool
+	names  map[string]string
+	shell  string
+}
+
+func (f shellFormatter) Format(w io.Writer, _ []Account, entries []Entry) error {
+	for _, e := range entries {
+		if _, err := io.WriteString(w, f.line(e)+"\n"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (f shellFormatter) line(e Entry) string {
+	name := f.variable(e)
+
+	switch f.shell {
+	case shellFish:
+		if f.export {
+			return "set -gx " + name + " " + fishQuote(e.Value)
+		}
+
+		return "set -g " + name + " " + fishQuote(e.Value)
+	case shellPowerShell:
+		if f.export {
+			return "$env:" + name + " = " + powerShellQuote(e.Value)
+		}
+
+		return "$" + name + " = " + powerShellQuote(e.Value)
+	case shellBash:
+		return f.exportPrefix() + name + "=" + bashQuote(e.Value)
+	default:
+		return f.exportPrefix() + name + "=" + posixQuote(e.Value)
+	}
+}
+
+func (f shellFormatter) exportPrefix() string {
+	if f.export {
+		return "export "
+	}
+
+	return ""
+}
+
+// variable returns the variable name of the entry, as mapped by --var or made a valid identifier.
+func (f shellFormatter) variable(e Entry) string {
+	name, found := f.names[e.Name]
+	if !found {
+		name = e.Name
+	}
+
+	if e.Property != "" {
+		name = propertyName(name, e.Property)
+	}
+
+	return identifier(name)
+}
+
+// identifier replaces the characters not allowed in a shell variable name, which cannot start with a digit.
+func identifier(name string) string {
+	result := invalidIdentifierRegex.ReplaceAllString(name, "_")
+
+	if result == "" || unicode.IsDigit(rune(result[0])) {
+		result = "_" + result
+	}
+
+	return result
+}
+
+// posixQuote returns a single-quoted string, closing and reopening quotes around escaped single quotes.
+func posixQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// bashQuote returns an ANSI-C quoted string if the value has control characters, so that it stays on one line.
+func bashQuote(s string) string {
+	if !strings.ContainsFunc(s, unicode.IsControl) {
+		return posixQuote(s)
+	}
+
+	sb := strings.Builder{}
+
+	sb.WriteString("$'")
+
+	for _, r := range s {
+		switch r {
+		case '\\':
+			sb.WriteString(`\\`)
+		case '\'':
+			sb.WriteString(`\'`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\t':
+			sb.WriteString(`\t`)
+		default:
+			if unicode.IsControl(r) {
+				fmt.Fprintf(&sb, `\u%04x`, r)
+			} else {
+				sb.WriteRune(r)
+			}
+		}
+	}
+
+	sb.WriteString("'")
+
+	return sb.String()
+}
+
+// fishQuote returns a single-quoted string, in which fish only interprets \' and \\.
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+// powerShellQuote returns a single-quoted string, in which PowerShell only interprets doubled quotes,
+// typographic ones included.
+func powerShellQuote(s string) string {
+	return "'" + strings.NewReplacer(
+		"'", "''",
+		"‘", "‘‘",
+		"’", "’’",
+		"‚", "‚‚",
+		"‛", "‛‛",
+	).Replace(s) + "'"
+}
@@ -0,0 +1,86 @@
+package internal
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_shellFormatter(t *testing.T) {
+	entries := []Entry{
+		{Name: "my-db", Value: "it's"},
+		{Name: "my-db", Property: "UserName", Value: `a\b`},
+		{Name: "1st account", Value: "line1\nline2"},
+	}
+	tests := []struct {
+		name      string
+		formatter shellFormatter
+		want      string
+	}{
+		{
+			name:      "posix",
+			formatter: shellFormatter{shell: shellPosix},
+			want:      "my_db='it'\\''s'\nmy_db_UserName='a\\b'\n_1st_account='line1\nline2'\n",
+		},
+		{
+			name:      "posix export",
+			formatter: shellFormatter{export: true, shell: shellPosix},
+			want:      "export my_db='it'\\''s'\nexport my_db_UserName='a\\b'\nexport _1st_account='line1\nline2'\n",
+		},
+		{
+			name:      "bash",
+			formatter: shellFormatter{shell: shellBash},
+			want:      "my_db='it'\\''s'\nmy_db_UserName='a\\b'\n_1st_account=$'line1\\nline2'\n",
+		},
+		{
+			name:      "fish",
+			formatter: shellFormatter{export: true, shell: shellFish},
+			want:      "set -gx my_db 'it\\'s'\nset -gx my_db_UserName 'a\\\\b'\nset -gx _1st_account 'line1\nline2'\n",
+		},
+		{
+			name:      "powershell",
+			formatter: shellFormatter{shell: shellPowerShell},
+			want:      "$my_db = 'it''s'\n$my_db_UserName = 'a\\b'\n$_1st_account = 'line1\nline2'\n",
+		},
+		{
+			name:      "powershell export",
+			formatter: shellFormatter{export: true, shell: shellPowerShell},
+			want:      "$env:my_db = 'it''s'\n$env:my_db_UserName = 'a\\b'\n$env:_1st_account = 'line1\nline2'\n",
+		},
+		{
+			name: "names",
+			formatter: shellFormatter{
+				names: map[string]string{"my-db": "DB_PASSWORD", "1st account": "FIRST"},
+				shell: shellPosix,
+			},
+			want: "DB_PASSWORD='it'\\''s'\nDB_PASSWORD_UserName='a\\b'\nFIRST='line1\nline2'\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+
+			require.NoError(t, tt.formatter.Format(buf, nil, entries))
+			assert.Equal(t, tt.want, buf.String())
+		})
+	}
+}
+
+func Test_identifier(t *testing.T) {
+	assert.Equal(t, "OBJECT", identifier("OBJECT"))
+	assert.Equal(t, "my_app_db_password", identifier("my-app.db password"))
+	assert.Equal(t, "_1_OBJECT", identifier("1/OBJECT"))
+	assert.Equal(t, "_", identifier(""))
+}
+
+func Test_bashQuote(t *testing.T) {
+	assert.Equal(t, "'value'", bashQuote("value"))
+	assert.Equal(t, `$'it\'s\t\\\u0007'`, bashQuote("it's\t\\\a"))
+}
+
+func Test_powerShellQuote(t *testing.T) {
+	assert.Equal(t, "'it’’s ''ok'''", powerShellQuote("it’s 'ok'"))
+}
@@ -0,0 +1,134 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Stats tells how the accounts of a run were fetched: from the cache or from CyberArk, and how fast.
+type Stats struct {
+	Hits      int            `json:"hits"`
+	Misses    int            `json:"misses"`
+	Evictions int            `json:"evictions"`
+	Retries   int            `json:"retries"`
+	Accounts  []AccountStats `json:"accounts"`
+
+	mutex sync.Mutex
+}
+
+type AccountStats struct {
+	Object  string   `json:"object"`
+	Cached  bool     `json:"cached"`
+	Tries   int      `json:"tries"`
+	Latency duration `json:"latency"`
+}
+
+// duration is output as a string, e.g. 1.5s.
+type duration time.Duration
+
+func (d duration) MarshalJSON() ([]byte, error) {
+	return []byte(quote(time.Duration(d).String())), nil
+}
+
+// record adds the fetched accounts and the accounts evicted from the cache before, unless not recording.
+func (s *Stats) record(accounts []Account, evictions int) {
+	if s == nil {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.Evictions += evictions
+
+	for _, acct := range accounts {
+		if acct.fromCache {
+			s.Hits++
+		} else {
+			s.Misses++
+		}
+
+		if acct.Try > 1 {
+			s.Retries += acct.Try - 1
+		}
+
+		s.Accounts = append(s.Accounts, AccountStats{
+			Object:  acct.Object,
+			Cached:  acct.fromCache,
+			Tries:   acct.Try,
+			Latency: duration(acct.latency),
+		})
+	}
+}
+
+func (s *Stats) String() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	sb := strings.Builder{}
+
+	fmt.Fprintf(
+		&sb,
+		"%d hit(s), %d miss(es), %d eviction(s), %d retry(ies)",
+		s.Hits,
+		s.Misses,
+		s.Evictions,
+		s.Retries,
+	)
+
+	for _, as := range s.Accounts {
+		if as.Cached {
+			fmt.Fprintf(&sb, "\n  %s: cache", as.Object)
+		} else {
+			fmt.Fprintf(&sb, "\n  %s: %d try(ies) in %v", as.Object, as.Tries, time.Duration(as.Latency))
+		}
+	}
+
+	return sb.String()
+}
+
+// CacheStats aggregates the metadata of the cached accounts of a configuration.
+type CacheStats struct {
+	Accounts, Expired, Hits, Tries int
+	Oldest                         time.Duration
+	LastAccessed                   time.Time
+}
+
+func NewCacheStats(accounts []Account, now time.Time) CacheStats {
+	result := CacheStats{Accounts: len(accounts)}
+
+	for _, acct := range accounts {
+		if !now.Before(acct.expiresAt) {
+			result.Expired++
+		}
+
+		result.Hits += acct.Hits
+		result.Tries += acct.Try
+		result.Oldest = max(result.Oldest, now.Sub(acct.Timestamp))
+
+		if acct.AccessedAt.After(result.LastAccessed) {
+			result.LastAccessed = acct.AccessedAt
+		}
+	}
+
+	return result
+}
+
+func (cs CacheStats) String() string {
+	lastAccessed := "never"
+	if !cs.LastAccessed.IsZero() {
+		lastAccessed = cs.LastAccessed.Format(time.RFC3339)
+	}
+
+	return fmt.Sprintf(
+		"%d account(s), %d expired, %d hit(s), %d try(ies), oldest %v, last accessed %s",
+		cs.Accounts,
+		cs.Expired,
+		cs.Hits,
+		cs.Tries,
+		cs.Oldest.Truncate(time.Second),
+		lastAccessed,
+	)
+}
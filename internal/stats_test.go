@@ -0,0 +1,60 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStats(t *testing.T) {
+	cached := newCachedAccount("o1", "value1")
+	cached.fromCache = true
+
+	fetched := newCachedAccount("o2", "value2")
+	fetched.Try = 3
+	fetched.latency = 1500 * time.Millisecond
+
+	stats := &Stats{}
+
+	stats.record([]Account{cached, fetched}, 2)
+
+	assert.Equal(t, 1, stats.Hits)
+	assert.Equal(t, 1, stats.Misses)
+	assert.Equal(t, 2, stats.Evictions)
+	assert.Equal(t, 2, stats.Retries)
+	assert.Equal(
+		t,
+		"1 hit(s), 1 miss(es), 2 eviction(s), 2 retry(ies)\n  o1: cache\n  o2: 3 try(ies) in 1.5s",
+		stats.String(),
+	)
+}
+
+func TestNewCacheStats(t *testing.T) {
+	expired := newCachedAccount("o1", "value1")
+	expired.Timestamp = now.Add(-2 * time.Hour)
+	expired.expiresAt = now.Add(-time.Hour)
+	expired.Try = 1
+	expired.Hits = 4
+	expired.AccessedAt = now.Add(-time.Minute)
+
+	fresh := newCachedAccount("o2", "value2")
+	fresh.Try = 2
+	fresh.Hits = 1
+
+	stats := NewCacheStats([]Account{expired, fresh}, now)
+
+	assert.Equal(t, CacheStats{
+		Accounts:     2,
+		Expired:      1,
+		Hits:         5,
+		Tries:        3,
+		Oldest:       2 * time.Hour,
+		LastAccessed: now.Add(-time.Minute),
+	}, stats)
+	assert.Equal(
+		t,
+		"2 account(s), 1 expired, 5 hit(s), 3 try(ies), oldest 2h0m0s, last accessed 2023-02-21T19:44:48Z",
+		stats.String(),
+	)
+}
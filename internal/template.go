@@ -0,0 +1,225 @@
+package internal
+
+import (
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	commentPrefix    = "#"
+	placeholderEnd   = "}"
+	placeholderStart = "${CYBERARK:"
+)
+
+var keyRegex = regexp.MustCompile(`^([^#=][^=]*)=`)
+
+// template is a text read from stdin in which every ${CYBERARK:...} placeholder is substituted,
+// the surrounding text being kept byte for byte. Lines starting with # are comments and kept as is.
+type template struct {
+	lines []templateLine
+}
+
+type templateLine struct {
+	key      string // KEY of a KEY=VALUE line containing placeholders, used by file output
+	segments []segment
+}
+
+// segment is either raw text or a placeholder referencing an account.
+type segment struct {
+	text        string
+	ref         string
+	placeholder *placeholder
+}
+
+func parseTemplate(reader io.Reader) (template, error) {
+	var result template
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return result, err
+	}
+
+	for i, line := range strings.SplitAfter(string(data), "\n") {
+		if line == "" {
+			continue
+		}
+
+		tl, err := parseTemplateLine(line)
+		if err != nil {
+			return result, NewError(err, "invalid line %d", i+1)
+		}
+
+		result.lines = append(result.lines, tl)
+	}
+
+	return result, nil
+}
+
+func parseTemplateLine(line string) (templateLine, error) {
+	var result templateLine
+
+	if strings.HasPrefix(line, commentPrefix) {
+		result.segments = append(result.segments, segment{text: line})
+
+		return result, nil
+	}
+
+	rest := line
+
+	for {
+		start := strings.Index(rest, placeholderStart)
+		if start < 0 {
+			break
+		}
+
+		end := indexUnescaped(rest[start:], placeholderEnd[0])
+		if end < 0 {
+			break
+		}
+
+		ref, p, err := parsePlaceholder(rest[start+len(placeholderStart) : start+end])
+		if err != nil {
+			return result, err
+		}
+
+		if start > 0 {
+			result.segments = append(result.segments, segment{text: rest[:start]})
+		}
+
+		result.segments = append(result.segments, segment{
+			text:        rest[start : start+end+1],
+			ref:         ref,
+			placeholder: &p,
+		})
+		rest = rest[start+end+1:]
+	}
+
+	if rest != "" {
+		result.segments = append(result.segments, segment{text: rest})
+	}
+
+	if groups := keyRegex.FindStringSubmatch(line); groups != nil && result.hasPlaceholder() {
+		result.key = groups[1]
+	}
+
+	return result, nil
+}
+
+func (tl templateLine) hasPlaceholder() bool {
+	return ContainsFunc(tl.segments, func(s segment) bool {
+		return s.placeholder != nil
+	})
+}
+
+// accounts returns the accounts referenced by the template, each one only once.
+func (t template) accounts(now time.Time) []*Account {
+	accounts := make(map[string]*Account)
+	result := make([]*Account, 0)
+
+	for _, tl := range t.lines {
+		for _, s := range tl.segments {
+			if s.placeholder == nil {
+				continue
+			}
+
+			acct, found := accounts[s.ref]
+			if !found {
+				acct = newPlaceholderAccount(s.ref, now)
+				accounts[s.ref] = acct
+				result = append(result, acct)
+			}
+
+			acct.placeholders = append(acct.placeholders, *s.placeholder)
+		}
+	}
+
+	return result
+}
+
+// render substitutes the placeholders, leaving unresolved ones untouched.
+func (t template) render(accounts map[string]*Account) string {
+	sb := strings.Builder{}
+
+	for _, tl := range t.lines {
+		sb.WriteString(tl.render(accounts))
+	}
+
+	return sb.String()
+}
+
+func (tl templateLine) render(accounts map[string]*Account) string {
+	sb := strings.Builder{}
+
+	for _, s := range tl.segments {
+		sb.WriteString(s.render(accounts))
+	}
+
+	return sb.String()
+}
+
+// value returns the rendered value of a KEY=VALUE line, without its end of line.
+func (tl templateLine) value(accounts map[string]*Account) string {
+	result := strings.TrimPrefix(tl.render(accounts), tl.key+"=")
+
+	return strings.TrimRight(result, "\r\n")
+}
+
+func (tl templateLine) resolved(accounts map[string]*Account) bool {
+	for _, s := range tl.segments {
+		if s.placeholder == nil {
+			continue
+		}
+
+		acct, found := accounts[s.ref]
+		if !found {
+			return false
+		}
+
+		if _, ok := s.placeholder.value(acct); !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// account returns the account referenced by the first placeholder of the line.
+func (tl templateLine) account(accounts map[string]*Account) *Account {
+	for _, s := range tl.segments {
+		if s.placeholder != nil {
+			return accounts[s.ref]
+		}
+	}
+
+	return nil
+}
+
+func (s segment) render(accounts map[string]*Account) string {
+	if s.placeholder == nil {
+		return s.text
+	}
+
+	acct, found := accounts[s.ref]
+	if !found {
+		return s.text
+	}
+
+	value, ok := s.placeholder.value(acct)
+	if !ok {
+		return s.text
+	}
+
+	return value
+}
+
+func accountsByObject(accounts []Account) map[string]*Account {
+	result := make(map[string]*Account, len(accounts))
+
+	for i := range accounts {
+		result[accounts[i].Object] = &accounts[i]
+	}
+
+	return result
+}
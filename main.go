@@ -2,7 +2,6 @@ package main
 
 import (
 	"github.com/MartyHub/cac/cmd"
-	_ "github.com/mattn/go-sqlite3"
 )
 
 func main() {